@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// auditLogFlag is the --audit-log global flag, overriding the configuration file
+var auditLogFlag string
+
+// auditRecord is a line of the audit log, recording the issuance of a token
+type auditRecord struct {
+	Time        time.Time `json:"time"`
+	Cluster     string    `json:"cluster,omitempty"`
+	ClusterID   string    `json:"clusterID"`
+	Profile     string    `json:"profile"`
+	Region      string    `json:"region"`
+	IdentityARN string    `json:"identityARN,omitempty"`
+	RoleARN     string    `json:"roleARN,omitempty"`
+	Expiry      string    `json:"expiry"`
+	// Cache is "hit", "miss", "refresh" or "disabled"
+	Cache string `json:"cache"`
+	// PPID and ParentCommand identify the requesting process, usually kubectl
+	PPID          int    `json:"ppid"`
+	ParentCommand string `json:"parentCommand,omitempty"`
+}
+
+// auditLogTarget returns the audit log file path, "syslog", "stderr", or "" if auditing is disabled
+func auditLogTarget() string {
+	if auditLogFlag != "" {
+		return auditLogFlag
+	}
+	return settings.AuditLog
+}
+
+// auditEnabled reports whether token issuance is audited
+func auditEnabled() bool {
+	return auditLogTarget() != ""
+}
+
+// writeAuditRecord appends a record of the token issuance to the audit log, if enabled. Records are appended
+// as single lines with O_APPEND, so concurrent processes never interleave them.
+func writeAuditRecord(t tokenTarget, env cacheEnvelope, cache string) error {
+	target := auditLogTarget()
+	if target == "" {
+		return nil
+	}
+	r := auditRecord{
+		Time:          time.Now().UTC(),
+		Cluster:       t.cluster,
+		ClusterID:     t.clusterID,
+		Profile:       env.Profile,
+		Region:        env.Region,
+		IdentityARN:   env.IdentityARN,
+		RoleARN:       t.roleARN,
+		Expiry:        env.Credential.Status.ExpirationTimestamp,
+		Cache:         cache,
+		PPID:          os.Getppid(),
+		ParentCommand: parentCommand(),
+	}
+	if target == "stderr" {
+		return logEvent("Issued token",
+			slog.String("cluster", r.Cluster),
+			slog.String("clusterID", r.ClusterID),
+			slog.String("profile", r.Profile),
+			slog.String("region", r.Region),
+			slog.String("identityARN", r.IdentityARN),
+			slog.String("roleARN", r.RoleARN),
+			slog.String("expiry", r.Expiry),
+			slog.String("cache", r.Cache),
+			slog.Int("ppid", r.PPID),
+			slog.String("parentCommand", r.ParentCommand))
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if target == "syslog" {
+		return writeSyslog(string(data))
+	}
+	f, err := os.OpenFile(target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parentCommand returns the executable name of the parent process where the platform exposes it, i.e. on
+// Linux. Arguments are left out, as they may hold secrets.
+func parentCommand() string {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(os.Getppid()) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
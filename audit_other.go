@@ -0,0 +1,10 @@
+//go:build windows || plan9
+
+package main
+
+import "errors"
+
+// writeSyslog fails on platforms without syslog
+func writeSyslog(string) error {
+	return errors.New("syslog is not available on this platform")
+}
@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+
+package main
+
+import "log/syslog"
+
+// writeSyslog sends an audit record to the local syslog daemon
+func writeSyslog(msg string) error {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_INFO, "go-aws-eks-get-token")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return w.Info(msg)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// roleSessionName is the session name used for --role-arn, matching the AWS CLI
+const roleSessionName = "EKSGetTokenAuth"
+
+// loadFirstWorkingConfig loads the AWS config for each profile in order and returns the first one whose
+// credentials can actually be retrieved, together with the name of that profile. If roleARN is set, the
+// profile credentials are used to assume that role.
+func loadFirstWorkingConfig(
+	ctx context.Context,
+	region string,
+	roleARN string,
+	profiles []string,
+	optFns ...func(*config.LoadOptions) error,
+) (aws.Config, string, error) {
+	var errs []error
+	for _, profile := range profiles {
+		cfg, err := config.LoadDefaultConfig(ctx, append([]func(*config.LoadOptions) error{
+			config.WithRegion(region),
+			config.WithSharedConfigProfile(profile),
+			config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+				o.TokenProvider = mfaTokenProvider
+			}),
+		}, optFns...)...)
+		if err == nil && cfg.Region == "" {
+			err = errors.New("no region given by --region, AWS_REGION, AWS_DEFAULT_REGION or the profile")
+		}
+		if err == nil && roleARN != "" {
+			cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN,
+				func(o *stscreds.AssumeRoleOptions) {
+					o.RoleSessionName = roleSessionName
+				}))
+		}
+		var creds aws.Credentials
+		if err == nil {
+			creds, err = cfg.Credentials.Retrieve(ctx)
+			var expired *ssocreds.InvalidTokenError
+			if errors.As(err, &expired) {
+				if err = ssoLogin(ctx, profile); err == nil {
+					creds, err = cfg.Credentials.Retrieve(ctx)
+				}
+			}
+		}
+		if err == nil {
+			logger.Info("Using credentials", "profile", profile, "source", creds.Source, "region", cfg.Region)
+			return cfg, profile, nil
+		}
+		if len(profiles) > 1 {
+			logger.Warn("Profile has no working credentials", "profile", profile, "error", err)
+		}
+		errs = append(errs, fmt.Errorf("profile %q: %w", profile, err))
+	}
+	return aws.Config{}, "", errors.Join(errs...)
+}
+
+// clusterARN is the parsed form of an EKS cluster ARN, arn:aws:eks:REGION:ACCOUNT:cluster/NAME
+type clusterARN struct {
+	Region  string
+	Account string
+	Name    string
+}
+
+// parseClusterARN parses an EKS cluster ARN into its region, account and bare cluster name.
+func parseClusterARN(s string) (clusterARN, error) {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return clusterARN{}, err
+	}
+	name, ok := strings.CutPrefix(a.Resource, "cluster/")
+	if a.Service != "eks" || !ok || name == "" {
+		return clusterARN{}, fmt.Errorf("not an EKS cluster ARN: %s", s)
+	}
+	return clusterARN{Region: a.Region, Account: a.AccountID, Name: name}, nil
+}
+
+// sharedConfigFile returns the path of the AWS shared config file
+func sharedConfigFile() string {
+	if f := os.Getenv("AWS_CONFIG_FILE"); f != "" {
+		return f
+	}
+	return config.DefaultSharedConfigFilename()
+}
+
+// sharedConfigProfiles returns the names of all profiles in the AWS shared config file, in file order.
+func sharedConfigProfiles() ([]string, error) {
+	f, err := os.Open(sharedConfigFile())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var profiles []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+		section := strings.TrimSpace(line[1 : len(line)-1])
+		if section == "default" {
+			profiles = append(profiles, section)
+		} else if name, ok := strings.CutPrefix(section, "profile "); ok {
+			profiles = append(profiles, strings.TrimSpace(name))
+		}
+	}
+	return profiles, scanner.Err()
+}
+
+// profilesForAccount returns the profiles of the AWS shared config file that resolve to the given account,
+// either through an SSO account ID or the account of an assumed role.
+func profilesForAccount(ctx context.Context, account string) ([]string, error) {
+	names, err := sharedConfigProfiles()
+	if err != nil {
+		return nil, err
+	}
+	var matches []string
+	for _, name := range names {
+		sc, err := config.LoadSharedConfigProfile(ctx, name)
+		if err != nil {
+			continue
+		}
+		roleAccount := ""
+		if a, err := arn.Parse(sc.RoleARN); err == nil {
+			roleAccount = a.AccountID
+		}
+		if sc.SSOAccountID == account || roleAccount == account {
+			matches = append(matches, name)
+		}
+	}
+	return matches, nil
+}
+
+// profileRegion returns the region configured for a profile in the shared config files, or ""
+func profileRegion(ctx context.Context, profile string) string {
+	sc, err := config.LoadSharedConfigProfile(ctx, profile)
+	if err != nil {
+		return ""
+	}
+	return sc.Region
+}
+
+// identityFingerprint returns a short hash of the settings that determine which identity a profile resolves to,
+// computed without resolving credentials so that it can be checked before serving a cached token: the access
+// key ID of static credentials, the role, SSO account and role, credential process and web identity
+// settings of the profile and its source profiles, and the corresponding environment variables.
+func identityFingerprint(ctx context.Context, profile string) string {
+	h := sha256.New()
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE"} {
+		fmt.Fprintf(h, "%s=%s\n", name, os.Getenv(name))
+	}
+	if sc, err := config.LoadSharedConfigProfile(ctx, profile); err == nil {
+		for s := &sc; s != nil; s = s.Source {
+			fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%s\n%s\n%s\n%s\n", s.Profile, s.Credentials.AccessKeyID, s.RoleARN,
+				s.SSOAccountID, s.SSORoleName, s.CredentialSource, s.CredentialProcess, s.WebIdentityTokenFile)
+		}
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)[:8])
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// cacheFormatVersion is the version of the cache entry format written by this tool. Version 1 was the bare
+// ExecCredential.
+const cacheFormatVersion = 2
+
+// cacheEnvelope is a cached ExecCredential together with how it was minted
+type cacheEnvelope struct {
+	Version     int    `json:"version"`
+	ToolVersion string `json:"toolVersion,omitempty"`
+	Profile     string `json:"profile,omitempty"`
+	Region      string `json:"region,omitempty"`
+	ClusterID   string `json:"clusterID,omitempty"`
+	// IdentityARN is the caller identity the token was signed as, if known
+	IdentityARN string `json:"identityARN,omitempty"`
+	// IdentityFingerprint is the identityFingerprint of the profile when the token was minted
+	IdentityFingerprint string         `json:"identityFingerprint,omitempty"`
+	Credential          ExecCredential `json:"credential"`
+}
+
+// decodeCacheEntry parses a cache entry of the current or an older format. Older entries are returned with
+// their Version, so the caller can migrate them. Entries of unknown formats, e.g. written by a newer version,
+// are rejected.
+func decodeCacheEntry(data []byte) (cacheEnvelope, error) {
+	var probe struct {
+		Version int    `json:"version"`
+		Kind    string `json:"kind"`
+	}
+	var env cacheEnvelope
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return env, err
+	}
+	switch {
+	case probe.Version == cacheFormatVersion:
+		err := json.Unmarshal(data, &env)
+		return env, err
+	case probe.Version == 0 && probe.Kind == "ExecCredential":
+		env.Version = 1
+		err := json.Unmarshal(data, &env.Credential)
+		return env, err
+	default:
+		return env, fmt.Errorf("unsupported cache format version %d", probe.Version)
+	}
+}
+
+// validCachedToken returns whether a cached ExecCredential is still valid (expiry > padding). Tokens
+// outliving maxValidity (i.e. minted with a longer --token-duration) are ignored.
+func validCachedToken(cred ExecCredential, padding, maxValidity time.Duration) bool {
+	expiry, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp)
+	if err != nil {
+		return false
+	}
+	remaining := time.Until(expiry)
+	return remaining > padding && remaining <= maxValidity
+}
+
+// cacheLockTimeout bounds how long a process waits for another process minting the same token
+const cacheLockTimeout = 10 * time.Second
+
+// lockCache takes an advisory exclusive lock on the lock file belonging to a cache file, waiting up to
+// timeout. If the lock cannot be taken in time, the caller proceeds without it rather than failing, so a
+// stuck process can never block token generation for good. The returned function releases the lock.
+func lockCache(ctx context.Context, path string, timeout time.Duration) func() {
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return func() {}
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err == nil && locked {
+			return func() {
+				_ = unlockFile(f)
+				f.Close()
+			}
+		}
+		if err != nil || time.Now().After(deadline) || ctx.Err() != nil {
+			logger.Warn("Proceeding without lock", "path", f.Name())
+			f.Close()
+			return func() {}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// repeatInvocationWindow is how soon a second invocation by the same parent process, i.e. the same kubectl
+// process, for the same cluster is taken as a retry after the API server rejected the token
+const repeatInvocationWindow = 5 * time.Second
+
+// serveRecord records which process a token was last served to, and when
+type serveRecord struct {
+	PPID   int       `json:"ppid"`
+	Served time.Time `json:"served"`
+}
+
+// isRepeatInvocation reports whether a token for the cache file at path was served to the parent process
+// within repeatInvocationWindow. Separate kubectl processes, e.g. a script running kubectl in a loop, have
+// different parent PIDs and keep using the cache.
+func isRepeatInvocation(path string) bool {
+	data, err := os.ReadFile(path + ".served")
+	if err != nil {
+		return false
+	}
+	var r serveRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return false
+	}
+	return r.PPID == os.Getppid() && time.Since(r.Served) < repeatInvocationWindow
+}
+
+// recordServe records that a token for the cache file at path was served to the parent process. Failures
+// are ignored, as they only disable retry detection.
+func recordServe(path string) {
+	data, err := json.Marshal(serveRecord{PPID: os.Getppid(), Served: time.Now()})
+	if err == nil {
+		_ = writeFileAtomic(path+".served", data, 0600)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file in the directory of path and renames it into place, so a
+// crashed or killed process never leaves a truncated file behind.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp) // no-op once renamed
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cachePadding returns the expiry padding for cached tokens, extended by a random amount up to jitter so that
+// many clients minting tokens at the same moment don't all refresh at the same moment too.
+func cachePadding(padding, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return padding
+	}
+	return padding + rand.N(jitter)
+}
+
+// tokenCacheKey identifies a cached token. A token is only reused for the same profile, region, cluster,
+// assumed role, STS endpoint and additional signed headers, so switching any of them never serves a token
+// minted as another identity or for another endpoint.
+type tokenCacheKey struct {
+	profile   string
+	region    string
+	clusterID string
+	roleARN   string
+	// stsRegion is the --sts-region the token was signed for, if it differs from region
+	stsRegion string
+	headers   []signedHeader
+}
+
+// name returns the cache entry name for the key. The role ARN, STS region and headers are hashed, since they
+// may contain characters unsuitable for file names.
+func (k tokenCacheKey) name() string {
+	name := fmt.Sprintf("eks-token-%s-%s-%s", k.profile, k.region, k.clusterID)
+	stsRegion := k.stsRegion
+	if stsRegion == k.region {
+		// Signing for the default endpoint explicitly yields the same token
+		stsRegion = ""
+	}
+	if k.roleARN != "" || stsRegion != "" || len(k.headers) > 0 {
+		h := sha256.New()
+		fmt.Fprintf(h, "%s\n", k.roleARN)
+		if stsRegion != "" {
+			// Only hashed when set, so the names of existing entries stay the same
+			fmt.Fprintf(h, "sts-region=%s\n", stsRegion)
+		}
+		for _, hdr := range k.headers {
+			fmt.Fprintf(h, "%s=%s\n", strings.ToLower(hdr.name), hdr.value)
+		}
+		name += fmt.Sprintf("-%x", h.Sum(nil)[:6])
+	}
+	return name
+}
+
+// filename returns the cache file name for the key
+func (k tokenCacheKey) filename() string {
+	return k.name() + ".json"
+}
+
+// cacheEntryRegex matches cache entry names, eks-token-PROFILE-REGION-CLUSTERID[-HASH]. Profiles and cluster
+// IDs may contain dashes, so the region is what separates them.
+var cacheEntryRegex = regexp.MustCompile(`^eks-token-(.+)-([a-z]{2}(?:-[a-z]+)+-\d+)-(.+?)(?:-([0-9a-f]{12}))?$`)
+
+// cacheEntry is a cache entry name split into the parts of its key
+type cacheEntry struct {
+	name      string
+	profile   string
+	region    string
+	clusterID string
+	// hashed is whether the key included a role ARN, STS region or additional headers
+	hashed bool
+}
+
+// parseCacheEntry splits a cache entry name. Entries cached under the legacy name without region are not
+// recognized.
+func parseCacheEntry(name string) (cacheEntry, bool) {
+	m := cacheEntryRegex.FindStringSubmatch(name)
+	if m == nil {
+		return cacheEntry{}, false
+	}
+	return cacheEntry{name: name, profile: m[1], region: m[2], clusterID: m[3], hashed: m[4] != ""}, true
+}
+
+// kubeCacheFilePath returns the file path for the cached token, ensuring .kube and .kube/cache exist.
+func kubeCacheFilePath(key tokenCacheKey) (string, error) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, key.filename()), nil
+}
+
+// migrateLegacyCache moves a token cached under the former eks-token-PROFILE-CLUSTER.json name, which did not
+// include the region, to the path of the key, and so does it for tokens of the key left in ~/.kube/cache by
+// versions predating the XDG cache directory. A token is only kept if it was signed for the key's region;
+// otherwise it is removed so it can never be served for the wrong cluster.
+func migrateLegacyCache(key tokenCacheKey, path string) {
+	// Legacy names never included an assumed role, another STS endpoint or extra headers
+	regionless := ""
+	if key.roleARN == "" && (key.stsRegion == "" || key.stsRegion == key.region) && len(key.headers) == 0 {
+		regionless = fmt.Sprintf("eks-token-%s-%s.json", key.profile, key.clusterID)
+	}
+	var candidates []string
+	if regionless != "" {
+		candidates = append(candidates, filepath.Join(filepath.Dir(path), regionless))
+	}
+	if legacyDir := legacyCacheDir(); legacyDir != "" {
+		candidates = append(candidates, filepath.Join(legacyDir, key.filename()))
+		if regionless != "" {
+			candidates = append(candidates, filepath.Join(legacyDir, regionless))
+		}
+	}
+	signingRegion := key.region
+	if key.stsRegion != "" {
+		signingRegion = key.stsRegion
+	}
+	for _, legacyPath := range candidates {
+		data, err := os.ReadFile(legacyPath)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil && tokenRegion(data) == signingRegion {
+			if err := os.Rename(legacyPath, path); err == nil {
+				continue
+			}
+		}
+		_ = os.Remove(legacyPath)
+	}
+}
+
+// tokenRegion returns the signing region from the credential scope of a cached ExecCredential's token, or ""
+func tokenRegion(data []byte) string {
+	env, err := decodeCacheEntry(data)
+	if err != nil {
+		return ""
+	}
+	u, err := tokenURL(env.Credential.Status.Token)
+	if err != nil {
+		return ""
+	}
+	return credentialScope(u).region
+}
+
+// tokenURL decodes the presigned URL a token is made from
+func tokenURL(token string) (*url.URL, error) {
+	encoded, ok := strings.CutPrefix(token, "k8s-aws-v1.")
+	if !ok {
+		return nil, errors.New("not an EKS token")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(string(decoded))
+}
+
+// signingScope is the credential scope of a presigned URL
+type signingScope struct {
+	accessKeyID string
+	region      string
+}
+
+// credentialScope returns the credential scope of a presigned URL, empty if it has none
+func credentialScope(u *url.URL) signingScope {
+	// X-Amz-Credential is AKID/DATE/REGION/SERVICE/aws4_request
+	scope := strings.Split(u.Query().Get("X-Amz-Credential"), "/")
+	if len(scope) != 5 {
+		return signingScope{}
+	}
+	return signingScope{accessKeyID: scope[0], region: scope[2]}
+}
+
+// cacheDirFlag is the --cache-dir global flag, overriding all other cache directory settings
+var cacheDirFlag string
+
+// kubeCacheDir returns the cache directory, creating it if needed. It is --cache-dir, else
+// $EKS_GET_TOKEN_CACHE_DIR, else kubectl's $KUBECACHEDIR, else the cache-dir of the configuration file, else
+// $XDG_CACHE_HOME/eks-get-token on Linux. Elsewhere, or if the XDG directory cannot be created, it falls back
+// to ~/.kube/cache.
+func kubeCacheDir() (string, error) {
+	cacheDir := configuredCacheDir()
+	if cacheDir == "" && runtime.GOOS == "linux" {
+		if xdgCache, err := os.UserCacheDir(); err == nil {
+			dir := filepath.Join(xdgCache, "eks-get-token")
+			if err := os.MkdirAll(dir, 0700); err == nil {
+				return dir, nil
+			}
+		}
+	}
+	if cacheDir == "" {
+		home, err := kubeHomeDir()
+		if err != nil {
+			return "", err
+		}
+		kubeDir := filepath.Join(home, ".kube")
+		cacheDir = filepath.Join(kubeDir, "cache")
+	}
+
+	// Ensure the cache directory exists
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create cache directory %s: %w", cacheDir, err)
+	}
+	return cacheDir, nil
+}
+
+// configuredCacheDir returns the cache directory set by --cache-dir, the environment or the configuration
+// file, or "" for the default
+func configuredCacheDir() string {
+	for _, dir := range []string{cacheDirFlag, os.Getenv("EKS_GET_TOKEN_CACHE_DIR"), os.Getenv("KUBECACHEDIR"), settings.CacheDir} {
+		if dir != "" {
+			return dir
+		}
+	}
+	return ""
+}
+
+// legacyCacheDir returns ~/.kube/cache, where tokens were cached before the XDG cache directory became the
+// default on Linux, if the default cache directory is in use and is another one. It returns "" otherwise.
+func legacyCacheDir() string {
+	if configuredCacheDir() != "" {
+		return ""
+	}
+	home, err := kubeHomeDir()
+	if err != nil {
+		return ""
+	}
+	cacheDir, err := kubeCacheDir()
+	legacyDir := filepath.Join(home, ".kube", "cache")
+	if err != nil || cacheDir == legacyDir {
+		return ""
+	}
+	return legacyDir
+}
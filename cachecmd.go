@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// runCachePurge implements `cache purge`
+func runCachePurge(args []string) {
+	purgeCmd := flag.NewFlagSet("purge", flag.ExitOnError)
+	cluster := purgeCmd.String("cluster", "", "Remove the cached tokens of this cluster name, cluster ID or ARN")
+	all := purgeCmd.Bool("all", false, "Remove all cached tokens and discovery caches")
+	if err := purgeCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if (*cluster == "") == !*all {
+		fmt.Fprintln(os.Stderr, "exactly one of --cluster or --all is required")
+		os.Exit(exitUsage)
+	}
+	clusterID := *cluster
+	if a, err := parseClusterARN(clusterID); err == nil {
+		clusterID = a.Name
+	}
+
+	ctx := context.Background()
+	store, err := newTokenStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open token cache: %v\n", err)
+		os.Exit(1)
+	}
+	names, err := store.list(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list cached tokens: %v\n", err)
+		os.Exit(1)
+	}
+	failed := false
+	for _, name := range names {
+		if !*all {
+			e, ok := parseCacheEntry(name)
+			if !ok || e.clusterID != clusterID {
+				continue
+			}
+		}
+		if err := store.remove(ctx, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove %s: %v\n", name, err)
+			failed = true
+			continue
+		}
+		fmt.Println(name)
+	}
+
+	if *all {
+		// Discovered regions and endpoints are cached as files regardless of the backend
+		if err := purgeDiscoveryCaches(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to remove discovery caches: %v\n", err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// purgeDiscoveryCaches removes the cached discovered regions, endpoints and identities of all profiles
+func purgeDiscoveryCaches() error {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return err
+	}
+	for _, kind := range []string{"regions", "endpoints", "identities"} {
+		paths, err := filepath.Glob(filepath.Join(cacheDir, fmt.Sprintf("eks-%s-*.json", kind)))
+		if err != nil {
+			return err
+		}
+		for _, p := range paths {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+			fmt.Println(filepath.Base(p))
+		}
+	}
+	return nil
+}
+
+// runCacheList implements `cache list`
+func runCacheList(args []string) {
+	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	resolve := listCmd.Bool("resolve", false, "Resolve the identity ARN of valid tokens by sending them to STS")
+	if err := listCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	store, err := newTokenStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open token cache: %v\n", err)
+		os.Exit(1)
+	}
+	names, err := store.list(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list cached tokens: %v\n", err)
+		os.Exit(1)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tPROFILE\tREGION\tIDENTITY\tEXPIRES IN")
+	for _, name := range names {
+		e, ok := parseCacheEntry(name)
+		if !ok {
+			continue
+		}
+		cluster := e.clusterID
+		if e.hashed {
+			cluster += " (role/headers)"
+		}
+		identity, expiresIn := "-", "-"
+		if data, err := store.load(ctx, name); err == nil {
+			identity, expiresIn = describeCachedToken(ctx, data, e, *resolve)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", cluster, e.profile, e.region, identity, expiresIn)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// describeCachedToken returns the identity of a cached token and its time to expiry. The identity is the
+// caller identity ARN recorded in the cache entry or, for older entries, resolved if resolve is set and the
+// token is still valid, else the access key ID the token was signed with.
+func describeCachedToken(ctx context.Context, data []byte, e cacheEntry, resolve bool) (string, string) {
+	env, err := decodeCacheEntry(data)
+	if err != nil {
+		return "-", "-"
+	}
+	cred := env.Credential
+	identity, expiresIn := "-", "-"
+	remaining := time.Duration(0)
+	if expiry, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp); err == nil {
+		remaining = time.Until(expiry)
+		expiresIn = "expired"
+		if remaining > 0 {
+			expiresIn = remaining.Round(time.Second).String()
+		}
+	}
+	u, err := tokenURL(cred.Status.Token)
+	if err != nil {
+		return identity, expiresIn
+	}
+	if id := credentialScope(u).accessKeyID; id != "" {
+		identity = id
+	}
+	if env.IdentityARN != "" {
+		return env.IdentityARN, expiresIn
+	}
+	if resolve && remaining > 0 && !e.hashed {
+		if arn, err := tokenCallerIdentity(ctx, u, e.clusterID); err == nil {
+			identity = arn
+		}
+	}
+	return identity, expiresIn
+}
+
+// tokenCallerIdentity sends the presigned GetCallerIdentity request of a token to STS, just like the EKS
+// authenticator does, and returns the caller identity ARN.
+func tokenCallerIdentity(ctx context.Context, u *url.URL, clusterID string) (string, error) {
+	identity, err := sendTokenRequest(ctx, u, clusterID)
+	return identity.ARN, err
+}
+
+// sendTokenRequest sends the presigned GetCallerIdentity request of a token to STS with the x-k8s-aws-id
+// header and returns the caller identity. STS errors, e.g. a signature mismatch for another cluster ID, are
+// returned with their code and message.
+func sendTokenRequest(ctx context.Context, u *url.URL, clusterID string) (callerIdentity, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	req.Header.Set("x-k8s-aws-id", clusterID)
+	req.Header.Set("Accept", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// The error would quote the URL, signature included
+		return callerIdentity{}, fmt.Errorf("request to %s failed: %w", u.Host, urlErr.Err)
+	}
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var out struct {
+			Error struct {
+				Code    string
+				Message string
+			}
+		}
+		if json.NewDecoder(resp.Body).Decode(&out) == nil && out.Error.Code != "" {
+			return callerIdentity{}, fmt.Errorf("STS returned %s: %s: %s", resp.Status, out.Error.Code, out.Error.Message)
+		}
+		return callerIdentity{}, fmt.Errorf("STS returned %s", resp.Status)
+	}
+	var out struct {
+		GetCallerIdentityResponse struct {
+			GetCallerIdentityResult struct {
+				Account string
+				Arn     string
+				UserId  string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return callerIdentity{}, err
+	}
+	result := out.GetCallerIdentityResponse.GetCallerIdentityResult
+	return callerIdentity{Account: result.Account, ARN: result.Arn, UserID: result.UserId}, nil
+}
+
+// runCachePath implements `cache path`
+func runCachePath(g globalOptions, args []string) {
+	var opts getTokenOptions
+	pathCmd := flag.NewFlagSet("path", flag.ExitOnError)
+	cluster := pathCmd.String("cluster", "", "EKS cluster name or ARN (required)")
+	clusterID := pathCmd.String("cluster-id", "", "Value for the x-k8s-aws-id header (default --cluster)")
+	roleARN := pathCmd.String("role-arn", "", "IAM role assumed before signing")
+	pathCmd.StringVar(&opts.stsRegion, "sts-region", "", "Region of the STS endpoint the token was signed for")
+	pathCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Use the discovered region of the cluster, unless --region is given")
+	pathCmd.Func("header", "Additional `key=value` header signed into the token, may be repeated", func(s string) error {
+		h, err := parseSignedHeader(s)
+		if err != nil {
+			return err
+		}
+		opts.headers = append(opts.headers, h)
+		return nil
+	})
+	if err := pathCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if *cluster == "" {
+		fmt.Fprintln(os.Stderr, "--cluster is required")
+		os.Exit(exitUsage)
+	}
+
+	t, err := newTokenTarget(g, *cluster, *clusterID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve cluster: %v\n", err)
+		os.Exit(1)
+	}
+	t.roleARN = *roleARN
+
+	// Print the entry of every profile in the fallback chain, in the order they are tried
+	ctx := context.Background()
+	for _, profile := range t.profiles {
+		region := cacheRegion(ctx, opts, t, profile)
+		if region == "" {
+			fmt.Fprintf(os.Stderr, "Region unknown for profile %s, use --region\n", profile)
+			os.Exit(1)
+		}
+		key := tokenCacheKey{profile: profile, region: region, clusterID: t.clusterID, roleARN: t.roleARN, stsRegion: opts.stsRegion, headers: opts.headers}
+		if cacheBackend() == "keyring" {
+			fmt.Printf("keyring:%s/%s\n", keyringService, key.name())
+			continue
+		}
+		path, err := kubeCacheFilePath(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to get cache path: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(path)
+	}
+}
+
+// runCacheGC implements `cache gc`
+func runCacheGC(args []string) {
+	gcCmd := flag.NewFlagSet("gc", flag.ExitOnError)
+	expiredOnly := gcCmd.Bool("expired-only", false, "Keep tokens of clusters no longer in the kubeconfig")
+	if err := gcCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	store, err := newTokenStore()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open token cache: %v\n", err)
+		os.Exit(1)
+	}
+	var keep map[string]bool
+	if !*expiredOnly {
+		keep = kubeconfigClusterIDs()
+	}
+	removed, err := gcTokenCache(ctx, store, keep)
+	for _, name := range removed {
+		fmt.Println(name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to garbage collect token cache: %v\n", err)
+		os.Exit(1)
+	}
+	removed, err = gcLegacyCache(keep)
+	for _, path := range removed {
+		fmt.Println(path)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to garbage collect legacy token cache: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// runCacheStats implements `cache stats`
+func runCacheStats(args []string) {
+	statsCmd := flag.NewFlagSet("stats", flag.ExitOnError)
+	reset := statsCmd.Bool("reset", false, "Reset the statistics")
+	if err := statsCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+
+	path, err := statsFilePath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get statistics path: %v\n", err)
+		os.Exit(1)
+	}
+	if *reset {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Failed to reset statistics: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	stats := readStats(path)
+	clusters := make([]string, 0, len(stats.Clusters))
+	for c := range stats.Clusters {
+		clusters = append(clusters, c)
+	}
+	sort.Strings(clusters)
+
+	fmt.Printf("Since %s\n\n", stats.Since.Format(time.RFC3339))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tHITS\tMISSES\tMINTS\tHIT RATE")
+	for _, c := range clusters {
+		s := stats.Clusters[c]
+		rate := "-"
+		if total := s.Hits + s.Misses; total > 0 {
+			rate = fmt.Sprintf("%.1f%%", 100*float64(s.Hits)/float64(total))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\n", c, s.Hits, s.Misses, s.Mints, rate)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"time"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// defaultMaxClockSkew is the clock skew warned about unless --max-clock-skew is given
+const defaultMaxClockSkew = time.Minute
+
+// clockSkew returns how far the local clock is ahead of AWS, negative if it is behind, from the Date of the
+// response of an operation with the given result metadata. The Date has a resolution of a second.
+func clockSkew(metadata middleware.Metadata) (time.Duration, bool) {
+	serverTime, ok := awsmiddleware.GetServerTime(metadata)
+	if !ok {
+		return 0, false
+	}
+	responseAt, ok := awsmiddleware.GetResponseAt(metadata)
+	if !ok {
+		return 0, false
+	}
+	return responseAt.Sub(serverTime).Truncate(time.Second), true
+}
+
+// clockSkewHint explains what a clock skew does to tokens and how to fix it
+func clockSkewHint(skew time.Duration) string {
+	if skew > 0 {
+		return "the local clock is fast, so tokens may be rejected as not yet valid; sync it, e.g. with NTP, or pass get-token --clock-skew " + skew.String()
+	}
+	return "the local clock is slow, so tokens expire before their reported expiry; sync it, e.g. with NTP"
+}
+
+// warnClockSkew logs a warning if the local clock is off AWS by more than max, according to the response of
+// an operation with the given result metadata. A non-positive max disables the check.
+func warnClockSkew(metadata middleware.Metadata, max time.Duration) {
+	if max <= 0 {
+		return
+	}
+	if skew, ok := clockSkew(metadata); ok && skew.Abs() > max {
+		logger.Warn("Local clock is off AWS", "skew", skew, "hint", clockSkewHint(skew))
+	}
+}
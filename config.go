@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// fileConfig is the optional configuration file of this tool
+type fileConfig struct {
+	// Profiles is the profile fallback chain used when neither --profile nor AWS_PROFILE is set
+	Profiles []string `json:"profiles,omitempty"`
+	// Regions are the regions `eks update-kubeconfig --all` lists clusters in
+	Regions []string `json:"regions,omitempty"`
+	// CacheDir is the cache directory used when neither --cache-dir nor an environment variable sets it
+	CacheDir string `json:"cache-dir,omitempty"`
+	// CacheBackend is the token cache backend used when --cache-backend is not given
+	CacheBackend string `json:"cache-backend,omitempty"`
+	// CacheGetCommand and CachePutCommand are argv templates of commands reading and writing cached tokens
+	CacheGetCommand []string `json:"cache-get-command,omitempty"`
+	CachePutCommand []string `json:"cache-put-command,omitempty"`
+	// RemoteCache configures the shared dynamodb cache backend
+	RemoteCache remoteCache `json:"remote-cache,omitempty"`
+	// TouchID is the default of --touch-id
+	TouchID bool `json:"touch-id,omitempty"`
+	// CacheExpiryPadding is the default of --cache-expiry-padding
+	CacheExpiryPadding *duration `json:"cache-expiry-padding,omitempty"`
+	// Clusters holds per-cluster settings, keyed by cluster name or ID
+	Clusters map[string]clusterSettings `json:"clusters,omitempty"`
+	// AuditLog is the default of --audit-log
+	AuditLog string `json:"audit-log,omitempty"`
+	// CacheEncryption configures encryption of the file token cache
+	CacheEncryption cacheEncryption `json:"cache-encryption,omitempty"`
+	// ContextNameTemplate is the default of --context-name-template of `eks update-kubeconfig`
+	ContextNameTemplate string `json:"context-name-template,omitempty"`
+}
+
+// clusterSettings are settings overriding the defaults for a single cluster
+type clusterSettings struct {
+	// CacheExpiryPadding overrides the default of --cache-expiry-padding for the cluster
+	CacheExpiryPadding *duration `json:"cache-expiry-padding,omitempty"`
+}
+
+// duration is a time.Duration written as a string such as "2m30s" in the configuration file
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"2m\": %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// clusterSettings returns the settings of the target's cluster, looked up by cluster ID and then name
+func (c fileConfig) clusterSettings(t tokenTarget) clusterSettings {
+	if cs, ok := c.Clusters[t.clusterID]; ok {
+		return cs
+	}
+	return c.Clusters[t.cluster]
+}
+
+// settings is the loaded configuration file, empty if there is none
+var settings fileConfig
+
+// defaultConfigPath returns the configuration file path, $XDG_CONFIG_HOME/eks-get-token/config.yaml on
+// Linux and the platform's user config directory elsewhere.
+func defaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "eks-get-token", "config.yaml"), nil
+}
+
+// loadConfig reads the configuration file at path, or the default path if empty. A missing file at the
+// default path is not an error.
+func loadConfig(path string) (fileConfig, error) {
+	var cfg fileConfig
+	explicit := path != ""
+	if !explicit {
+		var err error
+		path, err = defaultConfigPath()
+		if err != nil {
+			return cfg, nil
+		}
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return cfg, nil
+}
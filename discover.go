@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+)
+
+const (
+	// Region used for listing the enabled regions when no other region is configured
+	discoveryBaseRegion = "us-east-1"
+	// Discovered cluster regions and endpoints are remembered this long
+	discoveryCacheTTL = 24 * time.Hour
+)
+
+// discoveryCacheEntry records a discovered value, e.g. the region of a cluster
+type discoveryCacheEntry struct {
+	Value      string    `json:"value"`
+	Discovered time.Time `json:"discovered"`
+}
+
+// discoverClusterRegion finds the region hosting the named cluster by listing clusters in all enabled
+// regions in parallel. Unless useCache is false, results are cached per profile in the .kube/cache directory.
+func discoverClusterRegion(ctx context.Context, cfg aws.Config, profile, cluster string, useCache bool) (string, error) {
+	var cachePath string
+	if useCache {
+		var err error
+		cachePath, err = discoveryCacheFilePath("regions", profile)
+		if err != nil {
+			return "", err
+		}
+		if region, ok := lookupDiscoveryCache(cachePath, cluster); ok {
+			logger.Info("Using discovered region from cache", "cluster", cluster, "region", region)
+			return region, nil
+		}
+	}
+
+	regionsOut, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to list enabled regions: %w", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		found []string
+		errs  []error
+	)
+	for _, r := range regionsOut.Regions {
+		region := aws.ToString(r.RegionName)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, err := regionHasCluster(ctx, cfg, region, cluster)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+			} else if ok {
+				found = append(found, region)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(found) == 0 {
+		return "", errors.Join(append([]error{fmt.Errorf("cluster %q not found in any enabled region", cluster)}, errs...)...)
+	}
+	if len(found) > 1 {
+		sort.Strings(found)
+		return "", fmt.Errorf("cluster %q exists in several regions (%v), use --region", cluster, found)
+	}
+
+	logger.Info("Discovered cluster region", "cluster", cluster, "region", found[0])
+	if useCache {
+		storeDiscoveryCache(cachePath, cluster, found[0])
+	}
+	return found[0], nil
+}
+
+// regionHasCluster reports whether the named cluster exists in the region
+func regionHasCluster(ctx context.Context, cfg aws.Config, region, cluster string) (bool, error) {
+	client := eks.NewFromConfig(cfg, func(o *eks.Options) {
+		o.Region = region
+	})
+	paginator := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return false, err
+		}
+		if slices.Contains(page.Clusters, cluster) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// discoverClusterByEndpoint finds the cluster in the config's region whose API server endpoint is server.
+// Unless useCache is false, results are cached per profile in the .kube/cache directory.
+func discoverClusterByEndpoint(ctx context.Context, cfg aws.Config, profile, server string, useCache bool) (string, error) {
+	var cachePath string
+	if useCache {
+		var err error
+		cachePath, err = discoveryCacheFilePath("endpoints", profile)
+		if err != nil {
+			return "", err
+		}
+		if cluster, ok := lookupDiscoveryCache(cachePath, server); ok {
+			logger.Info("Using discovered cluster from cache", "server", server, "cluster", cluster)
+			return cluster, nil
+		}
+	}
+
+	client := eks.NewFromConfig(cfg)
+	var names []string
+	paginator := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list clusters: %w", err)
+		}
+		names = append(names, page.Clusters...)
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		found string
+		errs  []error
+	)
+	for _, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			} else if sameEndpoint(aws.ToString(out.Cluster.Endpoint), server) {
+				found = name
+			}
+		}()
+	}
+	wg.Wait()
+
+	if found == "" {
+		return "", errors.Join(append([]error{fmt.Errorf("no cluster in %s has endpoint %s", cfg.Region, server)}, errs...)...)
+	}
+	logger.Info("Discovered cluster by endpoint", "server", server, "cluster", found)
+	if useCache {
+		storeDiscoveryCache(cachePath, server, found)
+	}
+	return found, nil
+}
+
+// sameEndpoint compares two API server URLs ignoring case and trailing slashes
+func sameEndpoint(a, b string) bool {
+	return strings.EqualFold(strings.TrimRight(a, "/"), strings.TrimRight(b, "/"))
+}
+
+// discoveryCacheFilePath returns the file path for discovered values of the given kind for a profile
+func discoveryCacheFilePath(kind, profile string) (string, error) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, fmt.Sprintf("eks-%s-%s.json", kind, profile)), nil
+}
+
+// readDiscoveryCache returns the cached values, or an empty cache if the file is missing or invalid
+func readDiscoveryCache(path string) map[string]discoveryCacheEntry {
+	cache := map[string]discoveryCacheEntry{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return map[string]discoveryCacheEntry{}
+	}
+	return cache
+}
+
+// lookupDiscoveryCache returns the cached value for key if it is younger than discoveryCacheTTL
+func lookupDiscoveryCache(path, key string) (string, bool) {
+	e, ok := readDiscoveryCache(path)[key]
+	if !ok || e.Value == "" || time.Since(e.Discovered) >= discoveryCacheTTL {
+		return "", false
+	}
+	return e.Value, true
+}
+
+// storeDiscoveryCache records a discovered value. Failures are reported but not fatal.
+func storeDiscoveryCache(path, key, value string) {
+	cache := readDiscoveryCache(path)
+	cache[key] = discoveryCacheEntry{Value: value, Discovered: time.Now().UTC()}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(path, data, 0600)
+	}
+	if err != nil {
+		logger.Warn("Failed to write discovery cache", "path", path, "error", err)
+	}
+}
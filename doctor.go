@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Statuses of doctor checks
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// doctorClusterID is the x-k8s-aws-id of the test token if no cluster is given
+const doctorClusterID = "eks-get-token-doctor"
+
+// doctorCheck is the outcome of a `doctor` check, with a hint how to fix it unless it passed
+type doctorCheck struct {
+	name   string
+	status string
+	detail string
+	hint   string
+}
+
+// runDoctor implements `doctor`
+func runDoctor(g globalOptions, args []string) {
+	doctorCmd := flag.NewFlagSet("doctor", flag.ExitOnError)
+	cluster := doctorCmd.String("cluster-name", "", "Also check the cluster, given by name or ARN, and the kubeconfig contexts for it")
+	roleARN := doctorCmd.String("role-arn", "", "IAM role to assume, as for get-token")
+	maxSkew := doctorCmd.Duration("max-clock-skew", defaultMaxClockSkew, "Warn when the local clock is off AWS by more than this")
+	if err := doctorCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if doctorCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: doctor [--cluster-name NAME] [--role-arn ARN] [--max-clock-skew DURATION]")
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	checks := append(doctorAWS(ctx, g, *cluster, *roleARN, *maxSkew), doctorCache(), doctorKubeconfig(*cluster))
+
+	failed, warned := false, false
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tCHECK\tDETAIL")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.status, c.name, c.detail)
+		if c.hint != "" && (c.status == checkFail || c.status == checkWarn) {
+			fmt.Fprintf(w, "\t\t-> %s\n", c.hint)
+		}
+		failed = failed || c.status == checkFail
+		warned = warned || c.status == checkWarn
+	}
+	w.Flush()
+	switch {
+	case failed:
+		os.Exit(exitFailure)
+	case warned:
+		os.Exit(exitValidationWarnings)
+	}
+}
+
+// doctorAWS checks the profile resolution, credentials, SSO session, region, STS and EKS endpoints and clock
+// of the AWS side, in this order. Checks depending on a failed one are skipped.
+func doctorAWS(ctx context.Context, g globalOptions, cluster, roleARN string, maxSkew time.Duration) []doctorCheck {
+	names := []string{"profile", "credentials", "sso session", "region", "sts endpoint", "clock", "token", "eks endpoint"}
+	var checks []doctorCheck
+	done := func(c ...doctorCheck) []doctorCheck {
+		checks = append(checks, c...)
+		for _, name := range names[len(checks):] {
+			checks = append(checks, doctorCheck{name: name, status: checkSkip, detail: "skipped after failed check"})
+		}
+		return checks
+	}
+
+	t, err := newTokenTarget(g, cluster, "")
+	if err != nil {
+		return done(doctorCheck{"profile", checkFail, err.Error(), "set AWS_PROFILE, pass --profile or list profiles in the configuration file"})
+	}
+	for _, p := range t.profiles {
+		var notExist config.SharedConfigProfileNotExistError
+		if _, err := config.LoadSharedConfigProfile(ctx, p); errors.As(err, &notExist) {
+			return done(doctorCheck{"profile", checkFail, fmt.Sprintf("profile %q not found", p),
+				fmt.Sprintf("add it to %s or fix the profile name", sharedConfigFile())})
+		}
+	}
+	checks = append(checks, doctorCheck{name: "profile", status: checkPass,
+		detail: fmt.Sprintf("%s (from %s)", strings.Join(t.profiles, ", "), profileSource(g, t))})
+
+	// The region is checked on its own below
+	cfg, profile, err := loadFirstWorkingConfig(ctx, t.region, roleARN, t.profiles, config.WithDefaultRegion(discoveryBaseRegion))
+	if err != nil {
+		hint := fmt.Sprintf("check the profile with 'aws sts get-caller-identity --profile %s'", t.profiles[0])
+		if errors.Is(err, errInteractionRequired) {
+			hint = "run get-token or 'aws sso login' in a terminal to sign in"
+		}
+		checks = append(checks, doctorCheck{"credentials", checkFail, err.Error(), hint})
+		return done(doctorSSO(ctx, t.profiles[0]))
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return done(doctorCheck{"credentials", checkFail, err.Error(), "check the credentials of the profile"})
+	}
+	detail := fmt.Sprintf("profile %s, source %s", profile, creds.Source)
+	if roleARN != "" {
+		detail += ", assuming " + roleARN
+	}
+	if creds.CanExpire {
+		detail += fmt.Sprintf(", expire in %s", time.Until(creds.Expires).Round(time.Second))
+	}
+	checks = append(checks, doctorCheck{name: "credentials", status: checkPass, detail: detail})
+	sso := doctorSSO(ctx, profile)
+	if sso.status == checkFail {
+		return done(sso)
+	}
+	checks = append(checks, sso)
+
+	region := cacheRegion(ctx, getTokenOptions{}, t, profile)
+	if region == "" {
+		checks = append(checks, doctorCheck{"region", checkWarn, "no region configured, using " + cfg.Region,
+			"pass --region, set AWS_REGION or set the region of the profile"})
+	} else {
+		cfg.Region = region
+		checks = append(checks, doctorCheck{name: "region", status: checkPass, detail: region})
+	}
+
+	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return done(doctorCheck{"sts endpoint", checkFail, err.Error(),
+			"check network access to STS in " + cfg.Region + ", e.g. proxy settings, and the IAM policy of the credentials"})
+	}
+	checks = append(checks, doctorCheck{name: "sts endpoint", status: checkPass,
+		detail: fmt.Sprintf("sts.%s, caller %s", cfg.Region, aws.ToString(out.Arn))})
+	checks = append(checks, doctorClock(out.ResultMetadata, maxSkew))
+
+	clusterID := t.clusterID
+	if clusterID == "" {
+		clusterID = doctorClusterID
+	}
+	presignedURL, _, err := mintToken(ctx, cfg, getTokenOptions{tokenDuration: maxTokenDuration}, clusterID)
+	if err != nil {
+		return done(doctorCheck{"token", checkFail, err.Error(), "check the credentials of the profile"})
+	}
+	if result := (tokenVerifier{clusterID: clusterID}).verify(ctx, "k8s-aws-v1."+encodeBase64Url(presignedURL)); !result.Valid {
+		return done(doctorCheck{"token", checkFail, "STS rejects tokens: " + result.Error, "check the clock and the credentials"})
+	}
+	checks = append(checks, doctorCheck{name: "token", status: checkPass, detail: "STS accepts tokens bound to " + clusterID})
+
+	return done(doctorEKS(ctx, cfg, t.cluster))
+}
+
+// profileSource names where newTokenTarget took the profiles of t from
+func profileSource(g globalOptions, t tokenTarget) string {
+	switch {
+	case len(g.profiles) > 0:
+		return "--profile"
+	case os.Getenv("AWS_PROFILE") != "":
+		return "AWS_PROFILE"
+	case slices.Equal(t.profiles, settings.Profiles):
+		return "configuration file"
+	default:
+		return "profiles matching the cluster account"
+	}
+}
+
+// doctorSSO checks the SSO session of the profile, or of the profile it sources credentials from, in the
+// token cache of the AWS CLI
+func doctorSSO(ctx context.Context, profile string) doctorCheck {
+	c := doctorCheck{name: "sso session", status: checkSkip, detail: "profile does not use SSO"}
+	sc, err := config.LoadSharedConfigProfile(ctx, profile)
+	if err != nil {
+		return c
+	}
+	var key string
+	for s := &sc; s != nil && key == ""; s = s.Source {
+		key = s.SSOSessionName
+		if key == "" {
+			key = s.SSOStartURL
+		}
+	}
+	if key == "" {
+		return c
+	}
+	c.hint = fmt.Sprintf("run 'aws sso login --profile %s'", profile)
+	path, err := ssocreds.StandardCachedTokenFilepath(key)
+	if err != nil {
+		c.status, c.detail = checkFail, err.Error()
+		return c
+	}
+	var token struct {
+		ExpiresAt time.Time `json:"expiresAt"`
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(data, &token)
+	}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		c.status, c.detail = checkFail, "not signed in to "+key
+	case err != nil:
+		c.status, c.detail = checkFail, fmt.Sprintf("cannot read SSO token of %s: %v", key, err)
+	case !time.Now().Before(token.ExpiresAt):
+		c.status, c.detail = checkFail, fmt.Sprintf("session of %s expired at %s", key, token.ExpiresAt.Local().Format(time.RFC3339))
+	default:
+		c.status, c.detail = checkPass, fmt.Sprintf("session of %s expires in %s", key, time.Until(token.ExpiresAt).Round(time.Minute))
+	}
+	return c
+}
+
+// doctorClock compares the local clock with the Date of an AWS response. Presigned tokens are rejected
+// before they are valid if the local clock is fast, and expire early if it is slow.
+func doctorClock(metadata middleware.Metadata, maxSkew time.Duration) doctorCheck {
+	skew, ok := clockSkew(metadata)
+	if !ok {
+		return doctorCheck{name: "clock", status: checkSkip, detail: "no Date in the STS response"}
+	}
+	detail := fmt.Sprintf("local clock %s ahead of AWS", skew)
+	if skew < 0 {
+		detail = fmt.Sprintf("local clock %s behind AWS", -skew)
+	}
+	if maxSkew > 0 && skew.Abs() > maxSkew {
+		return doctorCheck{"clock", checkWarn, detail, clockSkewHint(skew)}
+	}
+	return doctorCheck{name: "clock", status: checkPass, detail: detail}
+}
+
+// doctorEKS checks that the EKS API of the region answers, and that the cluster exists if one is given
+func doctorEKS(ctx context.Context, cfg aws.Config, cluster string) doctorCheck {
+	c := doctorCheck{name: "eks endpoint", status: checkPass}
+	client := eks.NewFromConfig(cfg)
+	var err error
+	if cluster != "" {
+		var out *eks.DescribeClusterOutput
+		out, err = client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(cluster)})
+		if err == nil {
+			c.detail = fmt.Sprintf("cluster %s in %s is %s", cluster, cfg.Region, out.Cluster.Status)
+		}
+	} else {
+		_, err = client.ListClusters(ctx, &eks.ListClustersInput{MaxResults: aws.Int32(1)})
+		c.detail = "eks." + cfg.Region + " answers"
+	}
+	var apiErr smithy.APIError
+	switch {
+	case err == nil:
+	case errors.As(err, &apiErr) && apiErr.ErrorCode() == "ResourceNotFoundException":
+		c.status, c.detail = checkFail, fmt.Sprintf("cluster %s not found in %s", cluster, cfg.Region)
+		c.hint = "pass the region of the cluster with --region, or the cluster ARN"
+	case errors.As(err, &apiErr):
+		c.status, c.detail = checkWarn, fmt.Sprintf("eks.%s answers, but %s", cfg.Region, apiErr.ErrorMessage())
+		c.hint = "grant the credentials eks:DescribeCluster and eks:ListClusters, which get-kubeconfig and discovery need"
+	default:
+		c.status, c.detail = checkFail, err.Error()
+		c.hint = "check network access to EKS in " + cfg.Region + ", e.g. proxy settings"
+	}
+	return c
+}
+
+// doctorCache checks the cache directory of the file backend is writable
+func doctorCache() doctorCheck {
+	c := doctorCheck{name: "cache", status: checkPass}
+	if backend := cacheBackend(); backend != "file" {
+		c.status, c.detail = checkSkip, backend+" backend"
+		return c
+	}
+	dir, err := kubeCacheDir()
+	if err == nil {
+		var f *os.File
+		if f, err = os.CreateTemp(dir, ".doctor-*"); err == nil {
+			f.Close()
+			err = os.Remove(f.Name())
+		}
+	}
+	if err != nil {
+		c.status, c.detail = checkFail, err.Error()
+		c.hint = "fix the permissions of the cache directory, pass --cache-dir or use --no-cache"
+		return c
+	}
+	c.detail = dir + " is writable"
+	return c
+}
+
+// doctorKubeconfig validates the kubeconfig like `kubeconfig validate`, only the contexts running get-token
+// for the cluster if one is given
+func doctorKubeconfig(cluster string) doctorCheck {
+	c := doctorCheck{name: "kubeconfig", status: checkPass}
+	kc, err := loadKubeconfig()
+	if err != nil {
+		c.status, c.detail, c.hint = checkFail, err.Error(), "fix or remove the kubeconfig file"
+		return c
+	}
+	findings := validateKubeconfig(kc)
+	contexts := len(kc.Contexts)
+	if cluster != "" {
+		name := cluster
+		if parsed, err := parseClusterARN(cluster); err == nil {
+			name = parsed.Name
+		}
+		var matching []string
+		for _, kctx := range kc.Contexts {
+			if user := kc.user(kctx.Context.AuthInfo); user != nil {
+				exec, ok := parseGetTokenExec(user.Exec)
+				if ok && (exec.Cluster == name || exec.Cluster == cluster || strings.HasSuffix(exec.Cluster, ":cluster/"+name)) {
+					matching = append(matching, kctx.Name)
+				}
+			}
+		}
+		if len(matching) == 0 {
+			c.status, c.detail = checkWarn, "no context runs get-token for cluster "+name
+			c.hint = "add one with 'eks update-kubeconfig --cluster-name " + cluster + "'"
+			return c
+		}
+		findings = slices.DeleteFunc(findings, func(f validationFinding) bool { return !slices.Contains(matching, f.context) })
+		contexts = len(matching)
+	}
+	errorCount := 0
+	for _, f := range findings {
+		if f.severity == severityError {
+			errorCount++
+		}
+	}
+	c.detail = fmt.Sprintf("%d contexts checked, %d errors, %d warnings", contexts, errorCount, len(findings)-errorCount)
+	if len(findings) > 0 {
+		c.status = checkWarn
+		if errorCount > 0 {
+			c.status = checkFail
+		}
+		c.hint = fmt.Sprintf("%s: %s; run 'kubeconfig validate' for all findings", orDash(findings[0].context), findings[0].message)
+	}
+	return c
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+// accessEntry is an EKS access entry with its associated access policies
+type accessEntry struct {
+	PrincipalARN string         `json:"principalArn"`
+	Type         string         `json:"type"`
+	Username     string         `json:"username"`
+	Groups       []string       `json:"kubernetesGroups"`
+	Policies     []accessPolicy `json:"accessPolicies"`
+}
+
+// accessPolicy is an access policy associated with an access entry
+type accessPolicy struct {
+	ARN string `json:"policyArn"`
+	// Scope is cluster or namespace
+	Scope      string   `json:"scope"`
+	Namespaces []string `json:"namespaces,omitempty"`
+}
+
+// String renders the policy by name and scope, e.g. AmazonEKSViewPolicy(ns:dev,test)
+func (p accessPolicy) String() string {
+	name := p.ARN[strings.LastIndex(p.ARN, "/")+1:]
+	if p.Scope == string(types.AccessScopeTypeNamespace) {
+		return fmt.Sprintf("%s(ns:%s)", name, strings.Join(p.Namespaces, ","))
+	}
+	return name + "(" + p.Scope + ")"
+}
+
+// runListAccessEntries implements `eks list-access-entries`
+func runListAccessEntries(g globalOptions, args []string) {
+	var opts getTokenOptions
+	listCmd := flag.NewFlagSet("list-access-entries", flag.ExitOnError)
+	cluster := listCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	roleARN := listCmd.String("role-arn", "", "IAM role to assume before listing")
+	principal := listCmd.String("principal-arn", "", "Only show the access entry of this IAM principal")
+	output := listCmd.String("output", "table", "Output format, 'table' or 'json'")
+	listCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	if err := listCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if listCmd.NArg() != 0 || *cluster == "" {
+		fmt.Fprintln(os.Stderr, "Usage: eks list-access-entries --cluster-name NAME [--principal-arn ARN] [--role-arn ARN] [--discover-region] [--output table|json]")
+		os.Exit(exitUsage)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'table' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	cfg, t, err := loadClusterConfig(ctx, g, opts, *cluster, *roleARN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list access entries: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	var entries []accessEntry
+	if *principal != "" {
+		var entry accessEntry
+		entry, err = describeAccessEntry(ctx, eks.NewFromConfig(cfg), t.cluster, *principal)
+		entries = []accessEntry{entry}
+	} else {
+		entries, err = listAccessEntries(ctx, cfg, t.cluster)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list access entries: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal access entries: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRINCIPAL\tTYPE\tUSERNAME\tGROUPS\tPOLICIES")
+	for _, e := range entries {
+		var policies []string
+		for _, p := range e.Policies {
+			policies = append(policies, p.String())
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.PrincipalARN, orDash(e.Type), orDash(e.Username),
+			orDash(strings.Join(e.Groups, ",")), orDash(strings.Join(policies, ",")))
+	}
+	w.Flush()
+}
+
+// listAccessEntries lists the access entries of a cluster and describes them in parallel, in the order
+// listed
+func listAccessEntries(ctx context.Context, cfg aws.Config, cluster string) ([]accessEntry, error) {
+	client := eks.NewFromConfig(cfg)
+	var principals []string
+	paginator := eks.NewListAccessEntriesPaginator(client, &eks.ListAccessEntriesInput{ClusterName: aws.String(cluster)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, accessEntriesError(err)
+		}
+		principals = append(principals, page.AccessEntries...)
+	}
+
+	entries := make([]accessEntry, len(principals))
+	errs := make([]error, len(principals))
+	var wg sync.WaitGroup
+	for i, principal := range principals {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entries[i], errs[i] = describeAccessEntry(ctx, client, cluster, principal)
+		}()
+	}
+	wg.Wait()
+	return entries, errors.Join(errs...)
+}
+
+// describeAccessEntry describes the access entry of a principal with its associated access policies
+func describeAccessEntry(ctx context.Context, client *eks.Client, cluster, principal string) (accessEntry, error) {
+	out, err := client.DescribeAccessEntry(ctx, &eks.DescribeAccessEntryInput{ClusterName: aws.String(cluster), PrincipalArn: aws.String(principal)})
+	if err != nil {
+		return accessEntry{}, fmt.Errorf("failed to describe access entry of %s: %w", principal, accessEntriesError(err))
+	}
+	entry := accessEntry{
+		PrincipalARN: principal,
+		Type:         aws.ToString(out.AccessEntry.Type),
+		Username:     aws.ToString(out.AccessEntry.Username),
+		Groups:       out.AccessEntry.KubernetesGroups,
+	}
+	paginator := eks.NewListAssociatedAccessPoliciesPaginator(client, &eks.ListAssociatedAccessPoliciesInput{ClusterName: aws.String(cluster), PrincipalArn: aws.String(principal)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return accessEntry{}, fmt.Errorf("failed to list access policies of %s: %w", principal, err)
+		}
+		for _, p := range page.AssociatedAccessPolicies {
+			policy := accessPolicy{ARN: aws.ToString(p.PolicyArn)}
+			if p.AccessScope != nil {
+				policy.Scope, policy.Namespaces = string(p.AccessScope.Type), p.AccessScope.Namespaces
+			}
+			entry.Policies = append(entry.Policies, policy)
+		}
+	}
+	return entry, nil
+}
+
+// accessEntriesError explains the error EKS returns for clusters that only use the aws-auth ConfigMap
+func accessEntriesError(err error) error {
+	var invalid *types.InvalidRequestException
+	if errors.As(err, &invalid) {
+		return fmt.Errorf("%w (the cluster may use the aws-auth ConfigMap only, i.e. authentication mode CONFIG_MAP)", err)
+	}
+	return err
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+// clusterSummary is a cluster as listed by `eks list-clusters`
+type clusterSummary struct {
+	Name    string `json:"name"`
+	ARN     string `json:"arn"`
+	Region  string `json:"region"`
+	Version string `json:"version"`
+	Status  string `json:"status"`
+	// EndpointAccess is public, private or public+private
+	EndpointAccess string `json:"endpointAccess"`
+}
+
+// runListClusters implements `eks list-clusters`
+func runListClusters(g globalOptions, args []string) {
+	listCmd := flag.NewFlagSet("list-clusters", flag.ExitOnError)
+	listCmd.StringVar(&g.region, "region", g.region, "AWS region to list clusters in (default the global --region)")
+	allRegions := listCmd.Bool("all-regions", false, "List clusters in all enabled regions")
+	roleARN := listCmd.String("role-arn", "", "IAM role to assume before listing")
+	output := listCmd.String("output", "table", "Output format, 'table' or 'json'")
+	if err := listCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if listCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: eks list-clusters [--region R|--all-regions] [--role-arn ARN] [--output table|json]")
+		os.Exit(exitUsage)
+	}
+	if *allRegions && g.region != "" {
+		fmt.Fprintln(os.Stderr, "--region and --all-regions cannot be combined")
+		os.Exit(exitUsage)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'table' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	t, err := newTokenTarget(g, "", "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	t.roleARN = *roleARN
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	var cfg aws.Config
+	var regions []string
+	if *allRegions {
+		cfg, _, err = loadFirstWorkingConfig(ctx, "", t.roleARN, t.profiles, config.WithDefaultRegion(discoveryBaseRegion))
+		if err != nil {
+			err = withExitCode(exitCredentials, fmt.Errorf("failed to load AWS config: %w", err))
+		} else {
+			regions, err = enabledRegions(ctx, cfg)
+		}
+	} else {
+		cfg, _, err = loadTargetConfig(ctx, getTokenOptions{}, t)
+		regions = []string{cfg.Region}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list clusters: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	clusters, errs := describeAllClusters(ctx, cfg, regions)
+	failed := 0
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Failed to list clusters: %v\n", err)
+		failed = exitCode(err)
+	}
+	if *output == "json" {
+		data, err := json.MarshalIndent(clusters, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal clusters: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tREGION\tVERSION\tSTATUS\tENDPOINT")
+		for _, c := range clusters {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Name, c.Region, c.Version, c.Status, c.EndpointAccess)
+		}
+		w.Flush()
+	}
+	if failed != 0 {
+		os.Exit(failed)
+	}
+}
+
+// describeAllClusters lists and describes the clusters in the regions in parallel. The clusters are sorted
+// by region and name.
+func describeAllClusters(ctx context.Context, cfg aws.Config, regions []string) ([]clusterSummary, []error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		clusters []clusterSummary
+		errs     []error
+	)
+	for _, region := range regions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rcfg := cfg.Copy()
+			rcfg.Region = region
+			names, err := listClusters(ctx, rcfg)
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", region, err))
+				mu.Unlock()
+				return
+			}
+			for _, name := range names {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					desc, err := describeCluster(ctx, rcfg, name)
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						errs = append(errs, fmt.Errorf("%s/%s: failed to describe cluster: %w", region, name, err))
+						return
+					}
+					clusters = append(clusters, clusterSummary{
+						Name:           name,
+						ARN:            desc.ARN,
+						Region:         region,
+						Version:        desc.Version,
+						Status:         desc.Status,
+						EndpointAccess: desc.EndpointAccess,
+					})
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Region != clusters[j].Region {
+			return clusters[i].Region < clusters[j].Region
+		}
+		return clusters[i].Name < clusters[j].Name
+	})
+	return clusters, errs
+}
+
+// endpointAccess tells how the API server endpoint of a cluster can be reached: public, private or
+// public+private
+func endpointAccess(vpc *types.VpcConfigResponse) string {
+	switch {
+	case vpc == nil:
+		return "-"
+	case vpc.EndpointPublicAccess && vpc.EndpointPrivateAccess:
+		return "public+private"
+	case vpc.EndpointPrivateAccess:
+		return "private"
+	}
+	return "public"
+}
+
+// clusterDescription is a cluster as printed by `eks describe-cluster`
+type clusterDescription struct {
+	Name                     string            `json:"name"`
+	ARN                      string            `json:"arn"`
+	Region                   string            `json:"region"`
+	Status                   string            `json:"status"`
+	Version                  string            `json:"version"`
+	PlatformVersion          string            `json:"platformVersion"`
+	Endpoint                 string            `json:"endpoint"`
+	EndpointAccess           string            `json:"endpointAccess"`
+	CertificateAuthorityData string            `json:"certificateAuthorityData,omitempty"`
+	OIDCIssuer               string            `json:"oidcIssuer,omitempty"`
+	AuthenticationMode       string            `json:"authenticationMode,omitempty"`
+	CreatedAt                *time.Time        `json:"createdAt,omitempty"`
+	Tags                     map[string]string `json:"tags,omitempty"`
+}
+
+// runDescribeCluster implements `eks describe-cluster`
+func runDescribeCluster(g globalOptions, args []string) {
+	var opts getTokenOptions
+	describeCmd := flag.NewFlagSet("describe-cluster", flag.ExitOnError)
+	cluster := describeCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	roleARN := describeCmd.String("role-arn", "", "IAM role to assume before describing")
+	output := describeCmd.String("output", "text", "Output format, 'text' or 'json'")
+	describeCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	if err := describeCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if describeCmd.NArg() != 0 || *cluster == "" {
+		fmt.Fprintln(os.Stderr, "Usage: eks describe-cluster --cluster-name NAME [--role-arn ARN] [--discover-region] [--output text|json]")
+		os.Exit(exitUsage)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'text' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	cfg, t, err := loadClusterConfig(ctx, g, opts, *cluster, *roleARN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to describe cluster: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	desc, err := describeCluster(ctx, cfg, t.cluster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to describe cluster: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(desc, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal cluster: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Name:\t%s\n", desc.Name)
+	fmt.Fprintf(w, "ARN:\t%s\n", desc.ARN)
+	fmt.Fprintf(w, "Status:\t%s\n", desc.Status)
+	fmt.Fprintf(w, "Version:\t%s (%s)\n", desc.Version, desc.PlatformVersion)
+	fmt.Fprintf(w, "Endpoint:\t%s (%s)\n", desc.Endpoint, desc.EndpointAccess)
+	fmt.Fprintf(w, "CA:\t%s\n", describeCA(desc.CertificateAuthorityData))
+	fmt.Fprintf(w, "OIDC issuer:\t%s\n", orDash(desc.OIDCIssuer))
+	fmt.Fprintf(w, "Authentication mode:\t%s\n", orDash(desc.AuthenticationMode))
+	if desc.CreatedAt != nil {
+		fmt.Fprintf(w, "Created:\t%s\n", desc.CreatedAt.UTC().Format(time.RFC3339))
+	}
+	keys := slices.Sorted(maps.Keys(desc.Tags))
+	if len(keys) == 0 {
+		fmt.Fprintln(w, "Tags:\t-")
+	}
+	for i, k := range keys {
+		label := ""
+		if i == 0 {
+			label = "Tags:"
+		}
+		fmt.Fprintf(w, "%s\t%s=%s\n", label, k, desc.Tags[k])
+	}
+	w.Flush()
+}
+
+// loadClusterConfig resolves a cluster given by name or ARN and loads the AWS config for its region
+func loadClusterConfig(ctx context.Context, g globalOptions, opts getTokenOptions, cluster, roleARN string) (aws.Config, tokenTarget, error) {
+	t, err := newTokenTarget(g, cluster, "")
+	if err != nil {
+		return aws.Config{}, t, withExitCode(exitUsage, err)
+	}
+	t.roleARN = roleARN
+	cfg, _, err := loadTargetConfig(ctx, opts, t)
+	return cfg, t, err
+}
+
+// describeCluster describes the named cluster in the config's region
+func describeCluster(ctx context.Context, cfg aws.Config, name string) (clusterDescription, error) {
+	out, err := eks.NewFromConfig(cfg).DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+	if err != nil {
+		return clusterDescription{}, err
+	}
+	c := out.Cluster
+	desc := clusterDescription{
+		Name:            aws.ToString(c.Name),
+		ARN:             aws.ToString(c.Arn),
+		Region:          cfg.Region,
+		Status:          string(c.Status),
+		Version:         aws.ToString(c.Version),
+		PlatformVersion: aws.ToString(c.PlatformVersion),
+		Endpoint:        aws.ToString(c.Endpoint),
+		EndpointAccess:  endpointAccess(c.ResourcesVpcConfig),
+		CreatedAt:       c.CreatedAt,
+		Tags:            c.Tags,
+	}
+	if c.CertificateAuthority != nil {
+		desc.CertificateAuthorityData = aws.ToString(c.CertificateAuthority.Data)
+	}
+	if c.Identity != nil && c.Identity.Oidc != nil {
+		desc.OIDCIssuer = aws.ToString(c.Identity.Oidc.Issuer)
+	}
+	if c.AccessConfig != nil {
+		desc.AuthenticationMode = string(c.AccessConfig.AuthenticationMode)
+	}
+	return desc, nil
+}
+
+// describeCA summarizes base64 encoded PEM CA data by the subject, expiry and SHA-256 fingerprint of the
+// first certificate
+func describeCA(data string) string {
+	pemData, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || data == "" {
+		return "-"
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return "-"
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "-"
+	}
+	fingerprint := sha256.Sum256(cert.Raw)
+	return fmt.Sprintf("%s, expires %s, sha256 %x", cert.Subject.CommonName, cert.NotAfter.UTC().Format(time.DateOnly), fingerprint)
+}
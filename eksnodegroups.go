@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+)
+
+// nodegroupSummary is a managed nodegroup as listed by `eks list-nodegroups`
+type nodegroupSummary struct {
+	Name          string   `json:"name"`
+	Status        string   `json:"status"`
+	InstanceTypes []string `json:"instanceTypes"`
+	CapacityType  string   `json:"capacityType"`
+	MinSize       int32    `json:"minSize"`
+	DesiredSize   int32    `json:"desiredSize"`
+	MaxSize       int32    `json:"maxSize"`
+	Version       string   `json:"version"`
+	AMIType       string   `json:"amiType"`
+	// ReleaseVersion is the AMI release version
+	ReleaseVersion string `json:"releaseVersion"`
+}
+
+// runListNodegroups implements `eks list-nodegroups`
+func runListNodegroups(g globalOptions, args []string) {
+	var opts getTokenOptions
+	listCmd := flag.NewFlagSet("list-nodegroups", flag.ExitOnError)
+	cluster := listCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	roleARN := listCmd.String("role-arn", "", "IAM role to assume before listing")
+	output := listCmd.String("output", "table", "Output format, 'table' or 'json'")
+	listCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	if err := listCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if listCmd.NArg() != 0 || *cluster == "" {
+		fmt.Fprintln(os.Stderr, "Usage: eks list-nodegroups --cluster-name NAME [--role-arn ARN] [--discover-region] [--output table|json]")
+		os.Exit(exitUsage)
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'table' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	cfg, t, err := loadClusterConfig(ctx, g, opts, *cluster, *roleARN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list nodegroups: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	nodegroups, err := describeNodegroups(ctx, cfg, t.cluster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list nodegroups: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(nodegroups, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal nodegroups: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(nodegroups) == 0 {
+		fmt.Fprintf(os.Stderr, "No managed nodegroups in cluster %s\n", t.cluster)
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tINSTANCE TYPES\tCAPACITY\tMIN/DESIRED/MAX\tVERSION\tAMI TYPE\tRELEASE")
+	for _, n := range nodegroups {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d/%d/%d\t%s\t%s\t%s\n", n.Name, n.Status, orDash(strings.Join(n.InstanceTypes, ",")),
+			orDash(n.CapacityType), n.MinSize, n.DesiredSize, n.MaxSize, orDash(n.Version), orDash(n.AMIType), orDash(n.ReleaseVersion))
+	}
+	w.Flush()
+}
+
+// describeNodegroups lists the managed nodegroups of a cluster and describes them in parallel, sorted by name
+func describeNodegroups(ctx context.Context, cfg aws.Config, cluster string) ([]nodegroupSummary, error) {
+	client := eks.NewFromConfig(cfg)
+	var names []string
+	paginator := eks.NewListNodegroupsPaginator(client, &eks.ListNodegroupsInput{ClusterName: aws.String(cluster)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, page.Nodegroups...)
+	}
+
+	nodegroups := make([]nodegroupSummary, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := client.DescribeNodegroup(ctx, &eks.DescribeNodegroupInput{ClusterName: aws.String(cluster), NodegroupName: aws.String(name)})
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to describe nodegroup %s: %w", name, err)
+				return
+			}
+			n := out.Nodegroup
+			nodegroups[i] = nodegroupSummary{
+				Name:           name,
+				Status:         string(n.Status),
+				InstanceTypes:  n.InstanceTypes,
+				CapacityType:   string(n.CapacityType),
+				Version:        aws.ToString(n.Version),
+				AMIType:        string(n.AmiType),
+				ReleaseVersion: aws.ToString(n.ReleaseVersion),
+			}
+			if s := n.ScalingConfig; s != nil {
+				nodegroups[i].MinSize = aws.ToInt32(s.MinSize)
+				nodegroups[i].DesiredSize = aws.ToInt32(s.DesiredSize)
+				nodegroups[i].MaxSize = aws.ToInt32(s.MaxSize)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(nodegroups, func(i, j int) bool { return nodegroups[i].Name < nodegroups[j].Name })
+	return nodegroups, nil
+}
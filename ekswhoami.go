@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"sigs.k8s.io/yaml"
+)
+
+// Sources of the Kubernetes identity reported by eks whoami
+const (
+	mappingAccessEntry = "access entry"
+	mappingAWSAuth     = "aws-auth ConfigMap"
+)
+
+// whoamiResult is the caller identity and the Kubernetes identity a cluster maps it to
+type whoamiResult struct {
+	CallerARN string `json:"callerArn"`
+	Account   string `json:"account"`
+	UserID    string `json:"userId"`
+	// PrincipalARN is the IAM principal the cluster looks up, the role for assumed roles
+	PrincipalARN       string   `json:"principalArn"`
+	AuthenticationMode string   `json:"authenticationMode"`
+	MappedBy           string   `json:"mappedBy,omitempty"`
+	Username           string   `json:"username,omitempty"`
+	Groups             []string `json:"groups,omitempty"`
+	AccessPolicies     []string `json:"accessPolicies,omitempty"`
+	Notes              []string `json:"notes,omitempty"`
+}
+
+// runWhoami implements `eks whoami`
+func runWhoami(g globalOptions, args []string) {
+	var opts getTokenOptions
+	whoamiCmd := flag.NewFlagSet("whoami", flag.ExitOnError)
+	cluster := whoamiCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	roleARN := whoamiCmd.String("role-arn", "", "IAM role to assume, as for get-token")
+	output := whoamiCmd.String("output", "text", "Output format, 'text' or 'json'")
+	whoamiCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	if err := whoamiCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if whoamiCmd.NArg() != 0 || *cluster == "" {
+		fmt.Fprintln(os.Stderr, "Usage: eks whoami --cluster-name NAME [--role-arn ARN] [--discover-region] [--output text|json]")
+		os.Exit(exitUsage)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'text' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	cfg, t, err := loadClusterConfig(ctx, g, opts, *cluster, *roleARN)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve identity: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	// Mint tokens in the region the config was resolved for
+	t.region, t.regionGiven = cfg.Region, true
+	result, err := whoami(ctx, cfg, t)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to resolve identity: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal identity: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Caller:\t%s\n", result.CallerARN)
+		fmt.Fprintf(w, "Principal:\t%s\n", result.PrincipalARN)
+		fmt.Fprintf(w, "Authentication mode:\t%s\n", orDash(result.AuthenticationMode))
+		fmt.Fprintf(w, "Mapped by:\t%s\n", orDash(result.MappedBy))
+		fmt.Fprintf(w, "Username:\t%s\n", orDash(result.Username))
+		fmt.Fprintf(w, "Groups:\t%s\n", orDash(strings.Join(result.Groups, ", ")))
+		if result.MappedBy == mappingAccessEntry {
+			fmt.Fprintf(w, "Access policies:\t%s\n", orDash(strings.Join(result.AccessPolicies, ", ")))
+		}
+		w.Flush()
+		for _, n := range result.Notes {
+			fmt.Fprintf(os.Stderr, "Note: %s\n", n)
+		}
+	}
+	if result.MappedBy == "" {
+		os.Exit(1)
+	}
+}
+
+// whoami resolves the caller identity and how the cluster of t maps it: through an access entry, tried
+// first as EKS does, or through the aws-auth ConfigMap, read with a token of the caller. Failures to look
+// at either are recorded as notes.
+func whoami(ctx context.Context, cfg aws.Config, t tokenTarget) (whoamiResult, error) {
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return whoamiResult{}, withExitCode(exitCredentials, fmt.Errorf("failed to get caller identity: %w", err))
+	}
+	result := whoamiResult{
+		CallerARN: aws.ToString(identity.Arn),
+		Account:   aws.ToString(identity.Account),
+		UserID:    aws.ToString(identity.UserId),
+	}
+	principal, session := principalARN(result.CallerARN)
+	result.PrincipalARN = principal
+	desc, err := describeCluster(ctx, cfg, t.cluster)
+	if err != nil {
+		return result, fmt.Errorf("failed to describe cluster: %w", err)
+	}
+	result.AuthenticationMode = desc.AuthenticationMode
+	render := func(username string) string {
+		return renderUsername(username, result.Account, session)
+	}
+
+	if desc.AuthenticationMode != string(types.AuthenticationModeConfigMap) {
+		entry, err := findAccessEntry(ctx, eks.NewFromConfig(cfg), t.cluster, principal)
+		switch {
+		case err != nil:
+			result.Notes = append(result.Notes, fmt.Sprintf("cannot look up access entries: %v", err))
+		case entry != nil:
+			result.MappedBy, result.Username, result.Groups = mappingAccessEntry, render(entry.Username), entry.Groups
+			for _, p := range entry.Policies {
+				result.AccessPolicies = append(result.AccessPolicies, p.String())
+			}
+			return result, nil
+		}
+	}
+	if desc.AuthenticationMode == string(types.AuthenticationModeApi) {
+		return result, nil
+	}
+
+	mapping, err := awsAuthMapping(ctx, t, desc, principal, result.Account)
+	switch {
+	case err != nil:
+		result.Notes = append(result.Notes, fmt.Sprintf("cannot read the aws-auth ConfigMap: %v", err))
+	case mapping != nil:
+		result.MappedBy, result.Username, result.Groups = mappingAWSAuth, render(mapping.Username), mapping.Groups
+		if result.Username == "" {
+			// Accounts mapped as a whole are authenticated by ARN
+			result.Username = result.CallerARN
+		}
+	}
+	return result, nil
+}
+
+// principalARN returns the IAM principal the EKS authenticator maps a caller ARN to, the role for an
+// assumed-role session, and the session name
+func principalARN(caller string) (string, string) {
+	parsed, err := arn.Parse(caller)
+	if err != nil || parsed.Service != "sts" || !strings.HasPrefix(parsed.Resource, "assumed-role/") {
+		return caller, ""
+	}
+	parts := strings.Split(parsed.Resource, "/")
+	if len(parts) < 3 {
+		return caller, ""
+	}
+	parsed.Service, parsed.Resource = "iam", "role/"+parts[1]
+	return parsed.String(), parts[2]
+}
+
+// samePrincipal compares principal ARNs like the EKS authenticator: case-insensitive, ignoring role paths
+func samePrincipal(a, b string) bool {
+	strip := func(s string) string {
+		parsed, err := arn.Parse(s)
+		if err != nil || !strings.HasPrefix(parsed.Resource, "role/") {
+			return s
+		}
+		parsed.Resource = "role/" + parsed.Resource[strings.LastIndex(parsed.Resource, "/")+1:]
+		return parsed.String()
+	}
+	return strings.EqualFold(strip(a), strip(b))
+}
+
+// renderUsername fills in the placeholders of a mapped username the authenticator supports here
+func renderUsername(username, account, session string) string {
+	return strings.NewReplacer(
+		"{{AccountID}}", account,
+		"{{SessionName}}", strings.ReplaceAll(session, "@", "-"),
+		"{{SessionNameRaw}}", session,
+	).Replace(username)
+}
+
+// findAccessEntry returns the access entry of the principal, or nil if there is none
+func findAccessEntry(ctx context.Context, client *eks.Client, cluster, principal string) (*accessEntry, error) {
+	paginator := eks.NewListAccessEntriesPaginator(client, &eks.ListAccessEntriesInput{ClusterName: aws.String(cluster)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, accessEntriesError(err)
+		}
+		for _, p := range page.AccessEntries {
+			if samePrincipal(p, principal) {
+				entry, err := describeAccessEntry(ctx, client, cluster, p)
+				return &entry, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// awsAuthEntry is an entry of mapRoles or mapUsers of the aws-auth ConfigMap
+type awsAuthEntry struct {
+	RoleARN  string   `json:"rolearn"`
+	UserARN  string   `json:"userarn"`
+	Username string   `json:"username"`
+	Groups   []string `json:"groups"`
+}
+
+// awsAuthMapping reads the aws-auth ConfigMap from the API server with a token for t and returns the entry
+// mapping the principal, or nil if it is not mapped
+func awsAuthMapping(ctx context.Context, t tokenTarget, desc clusterDescription, principal, account string) (*awsAuthEntry, error) {
+	token, err := bearerToken(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	client, err := clusterHTTPClient(&Cluster{CertificateAuthorityData: desc.CertificateAuthorityData})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(desc.Endpoint, "/")+"/api/v1/namespaces/kube-system/configmaps/aws-auth", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, errors.New("API server returned 401 Unauthorized, the cluster does not accept tokens of this identity")
+	default:
+		return nil, fmt.Errorf("API server returned %s", resp.Status)
+	}
+	var configMap struct {
+		Data struct {
+			MapRoles    string `json:"mapRoles"`
+			MapUsers    string `json:"mapUsers"`
+			MapAccounts string `json:"mapAccounts"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&configMap); err != nil {
+		return nil, fmt.Errorf("failed to parse aws-auth ConfigMap: %w", err)
+	}
+
+	for _, data := range []string{configMap.Data.MapRoles, configMap.Data.MapUsers} {
+		var entries []awsAuthEntry
+		if err := yaml.Unmarshal([]byte(data), &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse aws-auth ConfigMap: %w", err)
+		}
+		for _, e := range entries {
+			if samePrincipal(e.RoleARN+e.UserARN, principal) {
+				return &e, nil
+			}
+		}
+	}
+	var accounts []string
+	if err := yaml.Unmarshal([]byte(configMap.Data.MapAccounts), &accounts); err != nil {
+		return nil, fmt.Errorf("failed to parse aws-auth ConfigMap: %w", err)
+	}
+	for _, a := range accounts {
+		if a == account {
+			return &awsAuthEntry{}, nil
+		}
+	}
+	return nil, nil
+}
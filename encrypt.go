@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// cacheEncryption configures encryption of the file token cache. At most one of the settings may be given.
+type cacheEncryption struct {
+	// AgeIdentityFile is an age identity file. Tokens are encrypted to AgeRecipients, or to the identity's own
+	// recipient if none are given, and decrypted with the identity.
+	AgeIdentityFile string   `json:"age-identity-file,omitempty"`
+	AgeRecipients   []string `json:"age-recipients,omitempty"`
+	// KMSKeyARN is a KMS key ARN tokens are encrypted with, using the credentials of the token's profile
+	KMSKeyARN string `json:"kms-key-arn,omitempty"`
+}
+
+// cacheAgeIdentityFlag and cacheKMSKeyFlag are the --cache-age-identity and --cache-kms-key-arn global flags,
+// overriding the configuration file
+var (
+	cacheAgeIdentityFlag string
+	cacheKMSKeyFlag      string
+)
+
+// cacheEncryptionSettings returns the cache encryption settings from the flags or the configuration file
+func cacheEncryptionSettings() cacheEncryption {
+	enc := settings.CacheEncryption
+	if cacheAgeIdentityFlag != "" {
+		enc = cacheEncryption{AgeIdentityFile: cacheAgeIdentityFlag}
+	}
+	if cacheKMSKeyFlag != "" {
+		enc = cacheEncryption{KMSKeyARN: cacheKMSKeyFlag}
+	}
+	return enc
+}
+
+// newEncryptedStore wraps store with the configured encryption, returning it unchanged if none is configured
+func newEncryptedStore(store tokenStore, enc cacheEncryption) (tokenStore, error) {
+	switch {
+	case enc.AgeIdentityFile != "" && enc.KMSKeyARN != "":
+		return nil, errors.New("age and KMS cache encryption are mutually exclusive")
+	case enc.AgeIdentityFile != "":
+		return newAgeTokenStore(store, enc.AgeIdentityFile, enc.AgeRecipients)
+	case len(enc.AgeRecipients) > 0:
+		return nil, errors.New("age recipients require an age identity file for decryption")
+	case enc.KMSKeyARN != "":
+		keyARN, err := arn.Parse(enc.KMSKeyARN)
+		if err != nil || keyARN.Service != "kms" {
+			return nil, fmt.Errorf("invalid KMS key ARN %q", enc.KMSKeyARN)
+		}
+		return kmsTokenStore{store: store, keyARN: enc.KMSKeyARN, region: keyARN.Region}, nil
+	}
+	return store, nil
+}
+
+// ageTokenStore encrypts tokens with age before passing them to the underlying store
+type ageTokenStore struct {
+	store      tokenStore
+	identities []age.Identity
+	recipients []age.Recipient
+}
+
+func newAgeTokenStore(store tokenStore, identityFile string, recipients []string) (ageTokenStore, error) {
+	s := ageTokenStore{store: store}
+	f, err := os.Open(identityFile)
+	if err != nil {
+		return s, fmt.Errorf("failed to open age identity file: %w", err)
+	}
+	defer f.Close()
+	s.identities, err = age.ParseIdentities(f)
+	if err != nil {
+		return s, fmt.Errorf("failed to parse age identity file %s: %w", identityFile, err)
+	}
+	if len(recipients) > 0 {
+		s.recipients, err = age.ParseRecipients(strings.NewReader(strings.Join(recipients, "\n")))
+		if err != nil {
+			return s, fmt.Errorf("failed to parse age recipients: %w", err)
+		}
+		return s, nil
+	}
+	for _, id := range s.identities {
+		x, ok := id.(*age.X25519Identity)
+		if !ok {
+			return s, errors.New("age recipients must be given for identities other than X25519")
+		}
+		s.recipients = append(s.recipients, x.Recipient())
+	}
+	return s, nil
+}
+
+func (s ageTokenStore) load(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.store.load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), s.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cached token: %w", err)
+	}
+	return io.ReadAll(r)
+}
+
+func (s ageTokenStore) save(ctx context.Context, name string, data []byte) error {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, s.recipients...)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	return s.store.save(ctx, name, buf.Bytes())
+}
+
+func (s ageTokenStore) list(ctx context.Context) ([]string, error) {
+	return s.store.list(ctx)
+}
+
+func (s ageTokenStore) remove(ctx context.Context, name string) error {
+	return s.store.remove(ctx, name)
+}
+
+// kmsTokenStore encrypts tokens with a KMS key before passing them to the underlying store. The ciphertext
+// is bound to the cache entry via the encryption context, so it cannot be swapped for another entry's.
+type kmsTokenStore struct {
+	store  tokenStore
+	keyARN string
+	region string
+}
+
+// client returns a KMS client using the credentials of the profile the named token is cached for
+func (s kmsTokenStore) client(ctx context.Context, name string) (*kms.Client, error) {
+	e, ok := parseCacheEntry(name)
+	if !ok {
+		return nil, fmt.Errorf("invalid cache entry name %s", name)
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(e.profile), config.WithRegion(s.region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config for KMS: %w", err)
+	}
+	return kms.NewFromConfig(cfg), nil
+}
+
+func (s kmsTokenStore) encryptionContext(name string) map[string]string {
+	return map[string]string{"eks-get-token-cache": name}
+}
+
+func (s kmsTokenStore) load(ctx context.Context, name string) ([]byte, error) {
+	data, err := s.store.load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	client, err := s.client(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob:    data,
+		KeyId:             aws.String(s.keyARN),
+		EncryptionContext: s.encryptionContext(name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cached token: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+func (s kmsTokenStore) save(ctx context.Context, name string, data []byte) error {
+	client, err := s.client(ctx, name)
+	if err != nil {
+		return err
+	}
+	out, err := client.Encrypt(ctx, &kms.EncryptInput{
+		Plaintext:         data,
+		KeyId:             aws.String(s.keyARN),
+		EncryptionContext: s.encryptionContext(name),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encrypt token: %w", err)
+	}
+	return s.store.save(ctx, name, out.CiphertextBlob)
+}
+
+func (s kmsTokenStore) list(ctx context.Context) ([]string, error) {
+	return s.store.list(ctx)
+}
+
+func (s kmsTokenStore) remove(ctx context.Context, name string) error {
+	return s.store.remove(ctx, name)
+}
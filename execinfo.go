@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// execCredentialInfo is the ExecCredential passed by kubectl in the KUBERNETES_EXEC_INFO environment variable
+type execCredentialInfo struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Spec       struct {
+		Cluster     *execClusterInfo `json:"cluster,omitempty"`
+		Interactive bool             `json:"interactive"`
+	} `json:"spec"`
+}
+
+// execClusterInfo describes the target cluster, present when the exec stanza sets provideClusterInfo: true
+type execClusterInfo struct {
+	Server                   string          `json:"server"`
+	TLSServerName            string          `json:"tls-server-name,omitempty"`
+	CertificateAuthorityData string          `json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string          `json:"proxy-url,omitempty"`
+	Config                   json.RawMessage `json:"config,omitempty"`
+}
+
+// execClusterConfig is the per-cluster configuration read from the client.authentication.k8s.io/exec
+// extension of a kubeconfig cluster entry
+type execClusterConfig struct {
+	ClusterName string `json:"cluster-name"`
+	ClusterID   string `json:"cluster-id"`
+	Region      string `json:"region"`
+	Profile     string `json:"profile"`
+	RoleARN     string `json:"role-arn"`
+}
+
+// Exec credential API versions understood by kubectl
+const (
+	execAPIVersionV1      = "client.authentication.k8s.io/v1"
+	execAPIVersionV1beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+// resolveExecAPIVersion returns the ExecCredential apiVersion to respond with: the override if given, which
+// may omit the group, else the version kubectl announced in KUBERNETES_EXEC_INFO, else v1beta1.
+func resolveExecAPIVersion(override string) (string, error) {
+	if override != "" {
+		switch override {
+		case "v1", execAPIVersionV1:
+			return execAPIVersionV1, nil
+		case "v1beta1", execAPIVersionV1beta1:
+			return execAPIVersionV1beta1, nil
+		}
+		return "", fmt.Errorf("unsupported exec API version %q, must be v1 or v1beta1", override)
+	}
+	info, err := readExecInfo()
+	if err != nil {
+		return "", err
+	}
+	if info != nil && (info.APIVersion == execAPIVersionV1 || info.APIVersion == execAPIVersionV1beta1) {
+		return info.APIVersion, nil
+	}
+	return execAPIVersionV1beta1, nil
+}
+
+// readExecInfo parses KUBERNETES_EXEC_INFO, returning nil if kubectl did not set it
+func readExecInfo() (*execCredentialInfo, error) {
+	env := os.Getenv("KUBERNETES_EXEC_INFO")
+	if env == "" {
+		return nil, nil
+	}
+	var info execCredentialInfo
+	if err := json.Unmarshal([]byte(env), &info); err != nil {
+		return nil, fmt.Errorf("invalid KUBERNETES_EXEC_INFO: %w", err)
+	}
+	return &info, nil
+}
+
+// clusterConfig returns the exec extension configuration of the cluster, if any
+func (c *execClusterInfo) clusterConfig() (execClusterConfig, error) {
+	var cfg execClusterConfig
+	if len(c.Config) == 0 || string(c.Config) == "null" {
+		return cfg, nil
+	}
+	if err := json.Unmarshal(c.Config, &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid exec extension in KUBERNETES_EXEC_INFO: %w", err)
+	}
+	return cfg, nil
+}
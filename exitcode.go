@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// Exit codes, so wrapper scripts can tell e.g. an expired SSO session from a typo in the cluster name
+const (
+	exitFailure             = 1
+	exitUsage               = 2
+	exitCredentials         = 3
+	exitInteractionRequired = 4
+	exitAWSAPI              = 5
+	exitCacheIO             = 6
+	exitTimeout             = 7
+	// exitValidationWarnings is returned by kubeconfig validate for findings that are not errors
+	exitValidationWarnings = 8
+)
+
+// exitCodeError attaches an exit code to an error
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// withExitCode attaches an exit code to err, keeping its message
+func withExitCode(code int, err error) error {
+	return &exitCodeError{code: code, err: err}
+}
+
+// exitCode classifies an error. Timeouts and required interaction take precedence over the codes attached
+// with withExitCode, e.g. for a credential failure caused by an expired SSO session; other AWS API errors
+// map to exitAWSAPI.
+func exitCode(err error) int {
+	var coded *exitCodeError
+	var apiErr smithy.APIError
+	var insecure *insecureCacheError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return exitTimeout
+	case errors.Is(err, errInteractionRequired):
+		return exitInteractionRequired
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.As(err, &insecure):
+		return exitCacheIO
+	case errors.As(err, &apiErr):
+		return exitAWSAPI
+	}
+	return exitFailure
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+const (
+	// Cached tokens are garbage collected once they expired this long ago
+	expiredCacheRetention = 24 * time.Hour
+	// Automatic garbage collection runs at most this often
+	cacheGCInterval = 24 * time.Hour
+)
+
+// gcTokenCache removes cached tokens that expired more than expiredCacheRetention ago, or that are corrupt.
+// Entries that fail to load, e.g. because the age identity is missing or KMS cannot be reached, are kept, so
+// that a passing outage never wipes the cache. If keep is not nil, tokens of cluster IDs not in keep are
+// removed too. It returns the names of the removed entries.
+func gcTokenCache(ctx context.Context, store tokenStore, keep map[string]bool) ([]string, error) {
+	names, err := store.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, name := range names {
+		if e, ok := parseCacheEntry(name); ok && keep != nil && !keep[e.clusterID] {
+			if err := store.remove(ctx, name); err != nil {
+				return removed, err
+			}
+			removed = append(removed, name)
+			continue
+		}
+		data, err := store.load(ctx, name)
+		if err != nil {
+			logger.Debug("Skipping unreadable cached token", "entry", name, "error", err)
+			continue
+		}
+		if !tokenExpiredSince(data, expiredCacheRetention) {
+			continue
+		}
+		if err := store.remove(ctx, name); err != nil {
+			return removed, err
+		}
+		removed = append(removed, name)
+	}
+	return removed, nil
+}
+
+// gcLegacyCache removes the tokens left in ~/.kube/cache by versions predating the XDG cache directory that
+// expired more than expiredCacheRetention ago or, if keep is not nil, whose cluster ID is not in keep. Tokens
+// that cannot be decoded are left alone, as they may be encrypted. It returns the paths of the removed files.
+func gcLegacyCache(keep map[string]bool) ([]string, error) {
+	legacyDir := legacyCacheDir()
+	if legacyDir == "" || cacheBackend() != "file" {
+		return nil, nil
+	}
+	paths, err := filepath.Glob(filepath.Join(legacyDir, "eks-token-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		e, parsed := parseCacheEntry(strings.TrimSuffix(filepath.Base(path), ".json"))
+		unreferenced := parsed && keep != nil && !keep[e.clusterID]
+		if _, err := decodeCacheEntry(data); err != nil || (!unreferenced && !tokenExpiredSince(data, expiredCacheRetention)) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// tokenExpiredSince reports whether a loaded cache entry expired more than d ago or is corrupt
+func tokenExpiredSince(data []byte, d time.Duration) bool {
+	env, err := decodeCacheEntry(data)
+	if err != nil {
+		return true
+	}
+	expiry, err := time.Parse(time.RFC3339, env.Credential.Status.ExpirationTimestamp)
+	if err != nil {
+		return true
+	}
+	return time.Since(expiry) > d
+}
+
+// autoGCTokenCache garbage collects expired tokens if the last collection is more than cacheGCInterval ago,
+// as recorded by the modification time of a stamp file in the cache directory. Errors are ignored, since
+// garbage collection must never fail token generation.
+func autoGCTokenCache(ctx context.Context, store tokenStore) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return
+	}
+	stamp := filepath.Join(cacheDir, "eks-gc-stamp")
+	if fi, err := os.Stat(stamp); err == nil && time.Since(fi.ModTime()) < cacheGCInterval {
+		return
+	}
+	if err := os.WriteFile(stamp, nil, 0600); err != nil {
+		return
+	}
+	_, _ = gcTokenCache(ctx, store, nil)
+	_, _ = gcLegacyCache(nil)
+}
+
+// kubeconfigClusterIDs returns the cluster IDs referenced by the kubeconfig: those of `eks get-token` exec
+// stanzas, cluster entries named by their ARN, and exec extensions of cluster entries. It returns nil if
+// the kubeconfig cannot be read or references no EKS cluster, so that nothing is collected by mistake.
+func kubeconfigClusterIDs() map[string]bool {
+	kc, err := loadKubeconfig()
+	if err != nil {
+		return nil
+	}
+	ids := map[string]bool{}
+	add := func(cluster, clusterID string) {
+		switch {
+		case clusterID != "":
+			ids[clusterID] = true
+		case arn.IsARN(cluster):
+			if a, err := parseClusterARN(cluster); err == nil {
+				ids[a.Name] = true
+			}
+		case cluster != "":
+			ids[cluster] = true
+		}
+	}
+	for _, u := range kc.Users {
+		if exec, ok := parseGetTokenExec(u.User.Exec); ok {
+			add(exec.Cluster, exec.ClusterID)
+		}
+	}
+	for _, c := range kc.Clusters {
+		if arn.IsARN(c.Name) {
+			add(c.Name, "")
+		}
+		for _, ext := range c.Cluster.Extensions {
+			var cfg execClusterConfig
+			if ext.Name == "client.authentication.k8s.io/exec" && json.Unmarshal(ext.Extension, &cfg) == nil {
+				add(cfg.ClusterName, cfg.ClusterID)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return ids
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"sigs.k8s.io/yaml"
+)
+
+// execCommand is the command written into exec stanzas of generated kubeconfigs
+const execCommand = "go-aws-eks-get-token"
+
+// runGetKubeconfig implements `eks get-kubeconfig`
+func runGetKubeconfig(g globalOptions, args []string) {
+	opts := getTokenOptions{
+		tokenDuration:  maxTokenDuration,
+		cachePadding:   cacheExpiryPadding,
+		execAPIVersion: execAPIVersionV1beta1,
+	}
+	if settings.CacheExpiryPadding != nil {
+		opts.cachePadding = time.Duration(*settings.CacheExpiryPadding)
+	}
+	getKubeconfigCmd := flag.NewFlagSet("get-kubeconfig", flag.ExitOnError)
+	cluster := getKubeconfigCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	roleARN := getKubeconfigCmd.String("role-arn", "", "IAM role to assume before signing the token")
+	standalone := getKubeconfigCmd.Bool("standalone", false, "Embed a token instead of an exec stanza, so the kubeconfig works without this tool until the token expires")
+	outFile := getKubeconfigCmd.String("out-file", "", "Write the kubeconfig to this file (mode 0600) instead of stdout")
+	getKubeconfigCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	getKubeconfigCmd.BoolVar(&opts.noCache, "no-cache", false, "Always mint a fresh token and never read or write the token cache")
+	if err := getKubeconfigCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if *cluster == "" {
+		fmt.Fprintln(os.Stderr, "--cluster-name is required")
+		os.Exit(exitUsage)
+	}
+
+	t, err := newTokenTarget(g, *cluster, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	t.roleARN = *roleARN
+	t.cachePadding = opts.cachePadding
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	cfg, profile, err := loadTargetConfig(ctx, opts, t)
+	if err != nil {
+		os.Exit(reportGetTokenError(g, err))
+	}
+	name, entry, err := describeKubeconfigCluster(ctx, cfg, t.cluster)
+	if err != nil {
+		os.Exit(reportGetTokenError(g, err))
+	}
+	user := AuthInfo{}
+	var expiry string
+	if *standalone {
+		// Reuse the resolved region, so the token is not minted for another region than described
+		t.region, t.regionGiven = cfg.Region, true
+		// A fresh token, as a cached one may be close to expiry and the kubeconfig cannot refresh it
+		opts.forceRefresh = true
+		data, _, err := getToken(ctx, opts, t)
+		if err != nil {
+			os.Exit(reportGetTokenError(g, err))
+		}
+		var cred ExecCredential
+		if err := json.Unmarshal(data, &cred); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to parse ExecCredential: %v\n", err)
+			os.Exit(1)
+		}
+		user.Token = cred.Status.Token
+		expiry = cred.Status.ExpirationTimestamp
+	} else {
+		user = execAuthInfo(cfg.Region, profile, t)
+	}
+
+	kc := Kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Clusters:       []NamedCluster{{Name: name, Cluster: entry}},
+		Users:          []NamedUser{{Name: name, User: user}},
+		Contexts:       []NamedContext{{Name: name, Context: Context{Cluster: name, AuthInfo: name}}},
+		CurrentContext: name,
+	}
+	data, err := yaml.Marshal(kc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to marshal kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	if *outFile != "" {
+		if err := writeFileAtomic(*outFile, data, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *outFile, err)
+			os.Exit(1)
+		}
+	} else {
+		if _, err := stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if expiry != "" {
+		fmt.Fprintf(os.Stderr, "Token expires at %s\n", expiry)
+	}
+}
+
+// describeKubeconfigCluster returns the ARN of the cluster, used as kubeconfig entry name like the AWS CLI
+// does, and its endpoint and CA
+func describeKubeconfigCluster(ctx context.Context, cfg aws.Config, cluster string) (string, Cluster, error) {
+	desc, err := describeCluster(ctx, cfg, cluster)
+	if err != nil {
+		return "", Cluster{}, fmt.Errorf("failed to describe cluster: %w", err)
+	}
+	return desc.ARN, Cluster{Server: desc.Endpoint, CertificateAuthorityData: desc.CertificateAuthorityData}, nil
+}
+
+// execAuthInfo returns a user running `eks get-token` of this tool for the target with the given region
+// and profile
+func execAuthInfo(region, profile string, t tokenTarget) AuthInfo {
+	exec := &ExecConfig{
+		APIVersion:      execAPIVersionV1beta1,
+		Command:         execCommand,
+		Args:            []string{"--region", region, "eks", "get-token", "--cluster-name", t.cluster},
+		Env:             []ExecEnvVar{{Name: "AWS_PROFILE", Value: profile}},
+		InteractiveMode: "IfAvailable",
+	}
+	if t.roleARN != "" {
+		exec.Args = append(exec.Args, "--role-arn", t.roleARN)
+	}
+	return AuthInfo{Exec: exec}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// commandTokenStore keeps tokens in external storage through user-configured commands, e.g. pass or the
+// vault CLI. The get command prints the cached ExecCredential on stdout, exiting non-zero if there is none,
+// and the put command reads it from stdin.
+type commandTokenStore struct {
+	get []*template.Template
+	put []*template.Template
+}
+
+// commandTemplateData is what argv templates of cache commands are expanded with
+type commandTemplateData struct {
+	Name      string
+	Profile   string
+	Region    string
+	ClusterID string
+}
+
+func newCommandTokenStore(get, put []string) (commandTokenStore, error) {
+	var s commandTokenStore
+	if len(get) == 0 || len(put) == 0 {
+		return s, errors.New("cache-get-command and cache-put-command must be configured together")
+	}
+	var err error
+	if s.get, err = parseArgvTemplate(get); err != nil {
+		return s, fmt.Errorf("invalid cache-get-command: %w", err)
+	}
+	if s.put, err = parseArgvTemplate(put); err != nil {
+		return s, fmt.Errorf("invalid cache-put-command: %w", err)
+	}
+	return s, nil
+}
+
+// parseArgvTemplate parses every argument of a command as a template
+func parseArgvTemplate(argv []string) ([]*template.Template, error) {
+	var tmpls []*template.Template
+	for _, arg := range argv {
+		t, err := template.New("arg").Option("missingkey=error").Parse(arg)
+		if err != nil {
+			return nil, err
+		}
+		tmpls = append(tmpls, t)
+	}
+	return tmpls, nil
+}
+
+// command expands an argv template for the named cache entry
+func (commandTokenStore) command(ctx context.Context, tmpls []*template.Template, name string) (*exec.Cmd, error) {
+	data := commandTemplateData{Name: name}
+	if e, ok := parseCacheEntry(name); ok {
+		data.Profile, data.Region, data.ClusterID = e.profile, e.region, e.clusterID
+	}
+	var argv []string
+	for _, t := range tmpls {
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		argv = append(argv, b.String())
+	}
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stderr = os.Stderr
+	return cmd, nil
+}
+
+func (s commandTokenStore) load(ctx context.Context, name string) ([]byte, error) {
+	cmd, err := s.command(ctx, s.get, name)
+	if err != nil {
+		return nil, err
+	}
+	// A missing entry is reported by a non-zero exit, which is not worth showing to the user
+	cmd.Stderr = nil
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("cache-get-command failed: %w", err)
+	}
+	return out, nil
+}
+
+func (s commandTokenStore) save(ctx context.Context, name string, data []byte) error {
+	cmd, err := s.command(ctx, s.put, name)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = bytes.NewReader(data)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cache-put-command failed: %w", err)
+	}
+	return nil
+}
+
+func (commandTokenStore) list(context.Context) ([]string, error) {
+	return nil, errors.New("listing cached tokens is not supported with cache command hooks")
+}
+
+func (commandTokenStore) remove(context.Context, string) error {
+	return errors.New("removing cached tokens is not supported with cache command hooks")
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// runInstall implements `install`
+func runInstall(g globalOptions, args []string) {
+	installCmd := flag.NewFlagSet("install", flag.ExitOnError)
+	contextName := installCmd.String("context", "", "Context whose user to rewrite (default the current context)")
+	profile := installCmd.String("profile", "", "AWS profile of the user (default the profile of the current stanza, else the global --profile)")
+	cluster := installCmd.String("cluster-name", "", "EKS cluster name or ARN (default taken from the current stanza or the cluster entry)")
+	roleARN := installCmd.String("role-arn", "", "IAM role to assume before signing the token (default taken from the current stanza)")
+	if err := installCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if installCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: install [--context NAME] [--profile P] [--cluster-name NAME] [--role-arn ARN]")
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name := merged.CurrentContext
+	if *contextName != "" {
+		if name, err = matchContext(merged, *contextName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	}
+	ctx := merged.context(name)
+	if ctx == nil {
+		fmt.Fprintln(os.Stderr, "No current context, use --context")
+		os.Exit(exitUsage)
+	}
+	user := merged.user(ctx.AuthInfo)
+	if user == nil {
+		fmt.Fprintf(os.Stderr, "User %q of context %q not found\n", ctx.AuthInfo, name)
+		os.Exit(1)
+	}
+
+	// Take what is known about the cluster from the current stanza, then from the cluster entry
+	info, ok := parseGetTokenExec(user.Exec)
+	if migrated, _, isMigratable := migrateExec(user.Exec); !ok && isMigratable {
+		info, _ = parseGetTokenExec(migrated)
+	}
+	entryCluster, _, entryRegion := eksClusterInfo(merged, ctx.Cluster)
+	info.Cluster = cmp.Or(*cluster, info.Cluster, entryCluster)
+	info.Region = cmp.Or(info.Region, entryRegion)
+	info.Profile = cmp.Or(*profile, info.Profile)
+	info.RoleARN = cmp.Or(*roleARN, info.RoleARN)
+	if info.Cluster == "" && info.ClusterID == "" {
+		fmt.Fprintf(os.Stderr, "The EKS cluster of context %q is unknown, use --cluster-name\n", name)
+		os.Exit(exitUsage)
+	}
+	t, err := execTokenTarget(g, info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	region := cmp.Or(t.region, os.Getenv("AWS_REGION"))
+	if region == "" {
+		fmt.Fprintf(os.Stderr, "The region of context %q is unknown, use the global --region\n", name)
+		os.Exit(exitUsage)
+	}
+	if len(t.profiles) > 1 {
+		fmt.Fprintf(os.Stderr, "An exec stanza takes a single profile, pick one of %s with --profile\n", strings.Join(t.profiles, ", "))
+		os.Exit(exitUsage)
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate this binary: %v\n", err)
+		os.Exit(1)
+	}
+	exec := installExec(user.Exec, execAuthInfo(region, t.profiles[0], t).Exec)
+	exec.Command = self
+	if t.clusterID != t.cluster {
+		exec.Args = append(exec.Args, "--cluster-id", t.clusterID)
+	}
+
+	path, err := updateUser(ctx.AuthInfo, func(u *AuthInfo) {
+		// Other credentials would take precedence over or conflict with the exec stanza
+		*u = AuthInfo{
+			Impersonate:          u.Impersonate,
+			ImpersonateUID:       u.ImpersonateUID,
+			ImpersonateGroups:    u.ImpersonateGroups,
+			ImpersonateUserExtra: u.ImpersonateUserExtra,
+			Exec:                 exec,
+			Extensions:           u.Extensions,
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to update kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("~ user %s (%s)\n", ctx.AuthInfo, path)
+	if user.Exec != nil {
+		fmt.Printf("  - %s\n", execCommandLine(user.Exec))
+	} else {
+		fmt.Printf("  - %s credentials\n", authType(user))
+	}
+	fmt.Printf("  + %s\n", execCommandLine(exec))
+	fmt.Fprintln(os.Stderr, "The previous kubeconfig was backed up, 'kubeconfig backup restore latest' undoes the change")
+}
+
+// installExec returns the stanza to install, keeping the env other than AWS_PROFILE and the supported
+// apiVersion and interactive mode of the previous stanza, if any
+func installExec(previous, exec *ExecConfig) *ExecConfig {
+	if previous == nil {
+		return exec
+	}
+	for _, env := range previous.Env {
+		if !slices.ContainsFunc(exec.Env, func(e ExecEnvVar) bool { return e.Name == env.Name }) {
+			exec.Env = append(exec.Env, env)
+		}
+	}
+	if slices.Contains(execAPIVersions, previous.APIVersion) {
+		exec.APIVersion = previous.APIVersion
+	}
+	exec.InteractiveMode = cmp.Or(previous.InteractiveMode, exec.InteractiveMode)
+	return exec
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// errInteractionRequired is returned when credentials need user input, e.g. an MFA code or an SSO login,
+// but prompting is not allowed
+var errInteractionRequired = errors.New("interaction required")
+
+// allowPrompts is whether the user may be prompted, see canPrompt
+var allowPrompts bool
+
+// canPrompt reports whether the user may be prompted for input. When run by kubectl, this follows the
+// interactive flag kubectl derives from the exec stanza's interactiveMode (false for Never, and for
+// IfAvailable without a terminal); in any case stdin must be a terminal.
+func canPrompt() (bool, error) {
+	info, err := readExecInfo()
+	if err != nil {
+		return false, err
+	}
+	if info != nil && !info.Spec.Interactive {
+		return false, nil
+	}
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false, nil
+	}
+	return fi.Mode()&os.ModeCharDevice != 0, nil
+}
+
+// mfaTokenProvider prompts for the MFA code of profiles with mfa_serial. The prompt goes to stderr, since
+// stdout is reserved for the ExecCredential.
+func mfaTokenProvider() (string, error) {
+	if !allowPrompts {
+		return "", fmt.Errorf("%w: the profile requires an MFA code", errInteractionRequired)
+	}
+	fmt.Fprint(os.Stderr, "Assume Role MFA token code: ")
+	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read MFA code: %w", err)
+	}
+	return strings.TrimSpace(code), nil
+}
+
+// ssoLogin runs `aws sso login` for the profile if prompting is allowed, so that an expired SSO session can be
+// renewed without leaving kubectl. Its output goes to stderr, since stdout is reserved for the ExecCredential.
+func ssoLogin(ctx context.Context, profile string) error {
+	if !allowPrompts {
+		return fmt.Errorf("%w: the SSO session has expired, run 'aws sso login --profile %s'", errInteractionRequired, profile)
+	}
+	fmt.Fprintf(os.Stderr, "The SSO session of profile %q has expired, running 'aws sso login'\n", profile)
+	cmd := exec.CommandContext(ctx, "aws", "sso", "login", "--profile", profile)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("aws sso login failed: %w", err)
+	}
+	return nil
+}
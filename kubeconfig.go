@@ -0,0 +1,442 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Kubeconfig is the kubeconfig file format (clientcmd v1 Config) as far as this tool needs to understand it.
+// Opaque parts such as extensions and auth providers are carried along unmodified.
+type Kubeconfig struct {
+	APIVersion     string           `json:"apiVersion,omitempty"`
+	Kind           string           `json:"kind,omitempty"`
+	Preferences    json.RawMessage  `json:"preferences,omitempty"`
+	Clusters       []NamedCluster   `json:"clusters"`
+	Users          []NamedUser      `json:"users"`
+	Contexts       []NamedContext   `json:"contexts"`
+	CurrentContext string           `json:"current-context"`
+	Extensions     []NamedExtension `json:"extensions,omitempty"`
+}
+
+// NamedCluster is a named cluster entry of a kubeconfig
+type NamedCluster struct {
+	Name    string  `json:"name"`
+	Cluster Cluster `json:"cluster"`
+}
+
+// Cluster holds the API server endpoint and TLS settings of a cluster
+type Cluster struct {
+	Server                   string           `json:"server"`
+	TLSServerName            string           `json:"tls-server-name,omitempty"`
+	InsecureSkipTLSVerify    bool             `json:"insecure-skip-tls-verify,omitempty"`
+	CertificateAuthority     string           `json:"certificate-authority,omitempty"`
+	CertificateAuthorityData string           `json:"certificate-authority-data,omitempty"`
+	ProxyURL                 string           `json:"proxy-url,omitempty"`
+	DisableCompression       bool             `json:"disable-compression,omitempty"`
+	Extensions               []NamedExtension `json:"extensions,omitempty"`
+}
+
+// NamedUser is a named user (AuthInfo) entry of a kubeconfig
+type NamedUser struct {
+	Name string   `json:"name"`
+	User AuthInfo `json:"user"`
+}
+
+// AuthInfo holds the credentials of a user
+type AuthInfo struct {
+	ClientCertificate     string              `json:"client-certificate,omitempty"`
+	ClientCertificateData string              `json:"client-certificate-data,omitempty"`
+	ClientKey             string              `json:"client-key,omitempty"`
+	ClientKeyData         string              `json:"client-key-data,omitempty"`
+	Token                 string              `json:"token,omitempty"`
+	TokenFile             string              `json:"tokenFile,omitempty"`
+	Impersonate           string              `json:"as,omitempty"`
+	ImpersonateUID        string              `json:"as-uid,omitempty"`
+	ImpersonateGroups     []string            `json:"as-groups,omitempty"`
+	ImpersonateUserExtra  map[string][]string `json:"as-user-extra,omitempty"`
+	Username              string              `json:"username,omitempty"`
+	Password              string              `json:"password,omitempty"`
+	AuthProvider          json.RawMessage     `json:"auth-provider,omitempty"`
+	Exec                  *ExecConfig         `json:"exec,omitempty"`
+	Extensions            []NamedExtension    `json:"extensions,omitempty"`
+}
+
+// ExecConfig is the exec credential plugin stanza of a user
+type ExecConfig struct {
+	APIVersion         string       `json:"apiVersion,omitempty"`
+	Command            string       `json:"command"`
+	Args               []string     `json:"args,omitempty"`
+	Env                []ExecEnvVar `json:"env,omitempty"`
+	InstallHint        string       `json:"installHint,omitempty"`
+	ProvideClusterInfo bool         `json:"provideClusterInfo,omitempty"`
+	InteractiveMode    string       `json:"interactiveMode,omitempty"`
+}
+
+// ExecEnvVar is an environment variable passed to an exec credential plugin
+type ExecEnvVar struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NamedContext is a named context entry of a kubeconfig
+type NamedContext struct {
+	Name    string  `json:"name"`
+	Context Context `json:"context"`
+}
+
+// Context ties a cluster and a user together
+type Context struct {
+	Cluster    string           `json:"cluster"`
+	AuthInfo   string           `json:"user"`
+	Namespace  string           `json:"namespace,omitempty"`
+	Extensions []NamedExtension `json:"extensions,omitempty"`
+}
+
+// NamedExtension is an opaque named extension
+type NamedExtension struct {
+	Name      string          `json:"name"`
+	Extension json.RawMessage `json:"extension"`
+}
+
+// kubeconfigPaths returns the kubeconfig files in effect, following the KUBECONFIG convention of kubectl.
+func kubeconfigPaths() ([]string, error) {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		var paths []string
+		for _, p := range filepath.SplitList(env) {
+			if p != "" {
+				paths = append(paths, p)
+			}
+		}
+		return paths, nil
+	}
+	home, err := kubeHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{filepath.Join(home, ".kube", "config")}, nil
+}
+
+// kubeHomeDir returns the home directory holding .kube. Like kubectl on Windows, %HOME% is preferred if it
+// contains a .kube directory, as set by e.g. Git Bash, before falling back to %USERPROFILE%.
+func kubeHomeDir() (string, error) {
+	if runtime.GOOS == "windows" {
+		if home := os.Getenv("HOME"); home != "" {
+			if _, err := os.Stat(filepath.Join(home, ".kube")); err == nil {
+				return home, nil
+			}
+		}
+	}
+	return os.UserHomeDir()
+}
+
+// readKubeconfig parses a single kubeconfig file, or stdin for "-"
+func readKubeconfig(path string) (*Kubeconfig, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+		path = "from stdin"
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kc Kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig %s: %w", path, err)
+	}
+	return &kc, nil
+}
+
+// loadKubeconfigFrom returns the kubeconfig in effect, or that of a --kubeconfig file or "-" for stdin
+func loadKubeconfigFrom(path string) (*Kubeconfig, error) {
+	if path == "" {
+		return loadKubeconfig()
+	}
+	return readKubeconfig(path)
+}
+
+// loadKubeconfig returns the merged view of the kubeconfig files in effect. Like kubectl, the first file
+// defining an entry or the current context wins, and missing files are ignored.
+func loadKubeconfig() (*Kubeconfig, error) {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return nil, err
+	}
+	merged := &Kubeconfig{APIVersion: "v1", Kind: "Config"}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		mergeKubeconfig(merged, kc)
+	}
+	return merged, nil
+}
+
+// mergeKubeconfig adds the entries of src not already present in dst
+func mergeKubeconfig(dst, src *Kubeconfig) {
+	if dst.CurrentContext == "" {
+		dst.CurrentContext = src.CurrentContext
+	}
+	for _, c := range src.Clusters {
+		if dst.cluster(c.Name) == nil {
+			dst.Clusters = append(dst.Clusters, c)
+		}
+	}
+	for _, u := range src.Users {
+		if dst.user(u.Name) == nil {
+			dst.Users = append(dst.Users, u)
+		}
+	}
+	for _, c := range src.Contexts {
+		if dst.context(c.Name) == nil {
+			dst.Contexts = append(dst.Contexts, c)
+		}
+	}
+}
+
+// cluster returns the named cluster, or nil
+func (kc *Kubeconfig) cluster(name string) *Cluster {
+	for i := range kc.Clusters {
+		if kc.Clusters[i].Name == name {
+			return &kc.Clusters[i].Cluster
+		}
+	}
+	return nil
+}
+
+// user returns the named user, or nil
+func (kc *Kubeconfig) user(name string) *AuthInfo {
+	for i := range kc.Users {
+		if kc.Users[i].Name == name {
+			return &kc.Users[i].User
+		}
+	}
+	return nil
+}
+
+// context returns the named context, or nil
+func (kc *Kubeconfig) context(name string) *Context {
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == name {
+			return &kc.Contexts[i].Context
+		}
+	}
+	return nil
+}
+
+// getTokenExec holds the arguments of an exec stanza invoking `eks get-token`, either through the AWS CLI
+// or this tool.
+type getTokenExec struct {
+	Cluster   string
+	ClusterID string
+	Region    string
+	Profile   string
+	RoleARN   string
+}
+
+// parseGetTokenExec extracts cluster name, region and profile from an `eks get-token` exec stanza.
+func parseGetTokenExec(exec *ExecConfig) (getTokenExec, bool) {
+	var g getTokenExec
+	if exec == nil {
+		return g, false
+	}
+	isGetToken := false
+	for i := 0; i < len(exec.Args); i++ {
+		arg := exec.Args[i]
+		if arg == "get-token" && i > 0 && exec.Args[i-1] == "eks" {
+			isGetToken = true
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		var target *string
+		switch name {
+		case "--cluster-name":
+			target = &g.Cluster
+		case "--cluster-id":
+			target = &g.ClusterID
+		case "--region":
+			target = &g.Region
+		case "--profile":
+			target = &g.Profile
+		case "--role-arn":
+			target = &g.RoleARN
+		default:
+			continue
+		}
+		if !hasValue && i+1 < len(exec.Args) {
+			i++
+			value = exec.Args[i]
+		}
+		*target = value
+	}
+	if !isGetToken || (g.Cluster == "" && g.ClusterID == "") {
+		return g, false
+	}
+	for _, env := range exec.Env {
+		switch {
+		case env.Name == "AWS_PROFILE" && g.Profile == "":
+			g.Profile = env.Value
+		case (env.Name == "AWS_REGION" || env.Name == "AWS_DEFAULT_REGION") && g.Region == "":
+			g.Region = env.Value
+		}
+	}
+	return g, true
+}
+
+// eksEndpointRegex matches EKS API server hostnames, e.g. ABCDEF.gr7.eu-west-1.eks.amazonaws.com
+var eksEndpointRegex = regexp.MustCompile(`\.([a-z0-9-]+)\.eks\.amazonaws\.com(\.cn)?$`)
+
+// eksRegionFromServer returns the region of an EKS API server URL, or "" if it is not an EKS endpoint
+func eksRegionFromServer(server string) string {
+	u, err := url.Parse(server)
+	if err != nil {
+		return ""
+	}
+	m := eksEndpointRegex.FindStringSubmatch(u.Hostname())
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// setCluster adds the named cluster, or updates the endpoint and CA of an existing one, keeping its other
+// settings such as a proxy URL
+func (kc *Kubeconfig) setCluster(name string, c Cluster) {
+	if existing := kc.cluster(name); existing != nil {
+		existing.Server = c.Server
+		existing.CertificateAuthority = ""
+		existing.CertificateAuthorityData = c.CertificateAuthorityData
+		return
+	}
+	kc.Clusters = append(kc.Clusters, NamedCluster{Name: name, Cluster: c})
+}
+
+// setUser adds the named user, or replaces the credentials of an existing one
+func (kc *Kubeconfig) setUser(name string, u AuthInfo) {
+	if existing := kc.user(name); existing != nil {
+		*existing = u
+		return
+	}
+	kc.Users = append(kc.Users, NamedUser{Name: name, User: u})
+}
+
+// setContext adds the named context, or points an existing one at the cluster and user, keeping its
+// namespace
+func (kc *Kubeconfig) setContext(name, cluster, user string) {
+	if existing := kc.context(name); existing != nil {
+		existing.Cluster = cluster
+		existing.AuthInfo = user
+		return
+	}
+	kc.Contexts = append(kc.Contexts, NamedContext{Name: name, Context: Context{Cluster: cluster, AuthInfo: user}})
+}
+
+// writeKubeconfig atomically replaces a kubeconfig file, creating its directory if needed. A symlinked
+// kubeconfig, e.g. into a dotfiles repository, is written through rather than replaced by a regular file.
+func writeKubeconfig(path string, kc *Kubeconfig) error {
+	data, err := yaml.Marshal(kc)
+	if err != nil {
+		return err
+	}
+	return writeKubeconfigData(path, data)
+}
+
+// writeKubeconfigData atomically replaces a kubeconfig file with raw data, like writeKubeconfig
+func writeKubeconfigData(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// deleteContext removes the named context, and the named cluster and user unless empty, clearing the
+// current context if it is the deleted one. It reports whether anything was removed.
+func (kc *Kubeconfig) deleteContext(name, cluster, user string) bool {
+	n := len(kc.Contexts) + len(kc.Clusters) + len(kc.Users)
+	kc.Contexts = slices.DeleteFunc(kc.Contexts, func(c NamedContext) bool { return c.Name == name })
+	kc.Clusters = slices.DeleteFunc(kc.Clusters, func(c NamedCluster) bool { return cluster != "" && c.Name == cluster })
+	kc.Users = slices.DeleteFunc(kc.Users, func(u NamedUser) bool { return user != "" && u.Name == user })
+	changed := n != len(kc.Contexts)+len(kc.Clusters)+len(kc.Users)
+	if kc.CurrentContext == name {
+		kc.CurrentContext = ""
+		changed = true
+	}
+	return changed
+}
+
+// renameContext renames a context, following it with the current context. It reports whether anything
+// changed.
+func (kc *Kubeconfig) renameContext(oldName, newName string) bool {
+	changed := false
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Name == oldName {
+			kc.Contexts[i].Name = newName
+			changed = true
+		}
+	}
+	if kc.CurrentContext == oldName {
+		kc.CurrentContext = newName
+		changed = true
+	}
+	return changed
+}
+
+// renameCluster renames a cluster and updates the contexts referencing it. It reports whether anything
+// changed.
+func (kc *Kubeconfig) renameCluster(oldName, newName string) bool {
+	changed := false
+	for i := range kc.Clusters {
+		if kc.Clusters[i].Name == oldName {
+			kc.Clusters[i].Name = newName
+			changed = true
+		}
+	}
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Context.Cluster == oldName {
+			kc.Contexts[i].Context.Cluster = newName
+			changed = true
+		}
+	}
+	return changed
+}
+
+// renameUser renames a user and updates the contexts referencing it. It reports whether anything changed.
+func (kc *Kubeconfig) renameUser(oldName, newName string) bool {
+	changed := false
+	for i := range kc.Users {
+		if kc.Users[i].Name == oldName {
+			kc.Users[i].Name = newName
+			changed = true
+		}
+	}
+	for i := range kc.Contexts {
+		if kc.Contexts[i].Context.AuthInfo == oldName {
+			kc.Contexts[i].Context.AuthInfo = newName
+			changed = true
+		}
+	}
+	return changed
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// kubeconfigBackupsKept is how many kubeconfig snapshots are kept, the oldest being removed first
+	kubeconfigBackupsKept = 50
+	// kubeconfigBackupHeader starts the comment line recording the path of the snapshotted file
+	kubeconfigBackupHeader = "# eks-get-token backup of "
+	// kubeconfigBackupTimeFormat is the timestamp starting the ID of a snapshot, sorting chronologically
+	kubeconfigBackupTimeFormat = "20060102T150405.000Z"
+)
+
+// kubeconfigBackup is a snapshot of a kubeconfig file
+type kubeconfigBackup struct {
+	id   string
+	path string
+	time time.Time
+}
+
+// kubeconfigBackupDir returns the directory of kubeconfig snapshots, ~/.kube/backups
+func kubeconfigBackupDir() (string, error) {
+	home, err := kubeHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".kube", "backups"), nil
+}
+
+// writeKubeconfigWithBackup snapshots a kubeconfig file before replacing it
+func writeKubeconfigWithBackup(path string, kc *Kubeconfig) error {
+	if err := backupKubeconfig(path); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return writeKubeconfig(path, kc)
+}
+
+// backupKubeconfig writes a timestamped snapshot of a kubeconfig file, if it exists, and removes the oldest
+// snapshots beyond kubeconfigBackupsKept
+func backupKubeconfig(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	dir, err := kubeconfigBackupDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	id := time.Now().UTC().Format(kubeconfigBackupTimeFormat) + "-" + filepath.Base(path)
+	if _, err := os.Stat(filepath.Join(dir, id+".yaml")); err == nil {
+		id = freeName(id, func(n string) bool {
+			_, err := os.Stat(filepath.Join(dir, n+".yaml"))
+			return err == nil
+		})
+	}
+	snapshot := append([]byte(kubeconfigBackupHeader+abs+"\n"), data...)
+	if err := writeFileAtomic(filepath.Join(dir, id+".yaml"), snapshot, 0600); err != nil {
+		return err
+	}
+
+	backups, err := listKubeconfigBackups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > kubeconfigBackupsKept {
+		if err := os.Remove(filepath.Join(dir, backups[0].id+".yaml")); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// listKubeconfigBackups returns the snapshots, oldest first
+func listKubeconfigBackups() ([]kubeconfigBackup, error) {
+	dir, err := kubeconfigBackupDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var backups []kubeconfigBackup
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".yaml")
+		if !ok || len(id) < len(kubeconfigBackupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(kubeconfigBackupTimeFormat, id[:len(kubeconfigBackupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		header, _, _ := bytes.Cut(data, []byte("\n"))
+		path, ok := strings.CutPrefix(string(header), kubeconfigBackupHeader)
+		if !ok {
+			continue
+		}
+		backups = append(backups, kubeconfigBackup{id: id, path: path, time: t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].id < backups[j].id })
+	return backups, nil
+}
+
+// runKubeconfigBackup implements `kubeconfig backup list|restore`
+func runKubeconfigBackup(args []string) {
+	backupCmd := flag.NewFlagSet("backup", flag.ExitOnError)
+	to := backupCmd.String("to", "", "With restore, write the snapshot to this file instead of the one it was taken of")
+	backupCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig backup list | kubeconfig backup restore [--to FILE] ID|latest")
+		backupCmd.PrintDefaults()
+	}
+	if len(args) == 0 {
+		backupCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	action := args[0]
+	if err := backupCmd.Parse(args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	backups, err := listKubeconfigBackups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list backups: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case action == "list" && backupCmd.NArg() == 0:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTIME\tFILE")
+		for i := len(backups) - 1; i >= 0; i-- {
+			b := backups[i]
+			fmt.Fprintf(w, "%s\t%s\t%s\n", b.id, b.time.Local().Format(time.DateTime), b.path)
+		}
+		if err := w.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	case action == "restore" && backupCmd.NArg() == 1:
+		id := backupCmd.Arg(0)
+		if id == "latest" && len(backups) > 0 {
+			id = backups[len(backups)-1].id
+		}
+		i := -1
+		for j, b := range backups {
+			if b.id == id {
+				i = j
+			}
+		}
+		if i < 0 {
+			fmt.Fprintf(os.Stderr, "no backup %q, see 'kubeconfig backup list'\n", id)
+			os.Exit(exitUsage)
+		}
+		target := backups[i].path
+		if *to != "" {
+			target = *to
+		}
+		if err := restoreKubeconfigBackup(backups[i], target); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to restore backup: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Restored %s to %s.\n", id, target)
+	default:
+		backupCmd.Usage()
+		os.Exit(exitUsage)
+	}
+}
+
+// restoreKubeconfigBackup writes a snapshot to path, snapshotting the file being replaced first so the
+// restore can be undone
+func restoreKubeconfigBackup(b kubeconfigBackup, path string) error {
+	dir, err := kubeconfigBackupDir()
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, b.id+".yaml"))
+	if err != nil {
+		return err
+	}
+	_, data, _ = bytes.Cut(data, []byte("\n"))
+	if err := backupKubeconfig(path); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return writeKubeconfigData(path, data)
+}
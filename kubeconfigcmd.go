@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// runKubeconfigUseContext implements `kubeconfig use-context`
+func runKubeconfigUseContext(args []string) {
+	useCmd := flag.NewFlagSet("use-context", flag.ExitOnError)
+	useCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig use-context NAME")
+		useCmd.PrintDefaults()
+	}
+	if err := useCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if useCmd.NArg() != 1 {
+		useCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name, err := matchContext(merged, useCmd.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if err := setCurrentContext(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set current context: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Switched to context %q.\n", name)
+}
+
+// matchContext resolves a context name given exactly, by the cluster name of a context named by the cluster
+// ARN, as unique prefix, or as unique substring
+func matchContext(kc *Kubeconfig, query string) (string, error) {
+	if kc.context(query) != nil {
+		return query, nil
+	}
+	for _, match := range []func(name string) bool{
+		func(name string) bool { return strings.HasSuffix(name, ":cluster/"+query) },
+		func(name string) bool { return strings.HasPrefix(name, query) },
+		func(name string) bool { return strings.Contains(name, query) },
+	} {
+		var names []string
+		for _, c := range kc.Contexts {
+			if match(c.Name) {
+				names = append(names, c.Name)
+			}
+		}
+		if len(names) == 1 {
+			return names[0], nil
+		}
+		if len(names) > 1 {
+			sort.Strings(names)
+			return "", fmt.Errorf("context %q is ambiguous, matching %s", query, strings.Join(names, ", "))
+		}
+	}
+	return "", fmt.Errorf("no context matches %q", query)
+}
+
+// setCurrentContext sets the current context in the kubeconfig file kubectl would write it to: the first
+// file setting a current context, else the first existing file, else the first file
+func setCurrentContext(name string) error {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return err
+	}
+	var target string
+	var kc *Kubeconfig
+	for _, path := range paths {
+		c, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if kc == nil || c.CurrentContext != "" {
+			target, kc = path, c
+		}
+		if c.CurrentContext != "" {
+			break
+		}
+	}
+	if kc == nil {
+		target, kc = paths[0], &Kubeconfig{APIVersion: "v1", Kind: "Config"}
+	}
+	kc.CurrentContext = name
+	return writeKubeconfig(target, kc)
+}
+
+// runKubeconfigDeleteContext implements `kubeconfig delete-context`
+func runKubeconfigDeleteContext(args []string) {
+	deleteCmd := flag.NewFlagSet("delete-context", flag.ExitOnError)
+	keepOrphans := deleteCmd.Bool("keep-orphans", false, "Keep the cluster and user of the context even if no other context references them")
+	deleteCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig delete-context [--keep-orphans] NAME")
+		deleteCmd.PrintDefaults()
+	}
+	if err := deleteCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if deleteCmd.NArg() != 1 {
+		deleteCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	name := deleteCmd.Arg(0)
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	if merged.context(name) == nil {
+		fmt.Fprintf(os.Stderr, "no context named %q\n", name)
+		os.Exit(exitUsage)
+	}
+	wasCurrent := merged.CurrentContext == name
+
+	orphanCluster, orphanUser, err := removeContext(merged, name, *keepOrphans)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete context: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Deleted context %q.\n", name)
+	if orphanCluster != "" {
+		fmt.Printf("Deleted cluster %q.\n", orphanCluster)
+	}
+	if orphanUser != "" {
+		fmt.Printf("Deleted user %q.\n", orphanUser)
+	}
+	if wasCurrent {
+		fmt.Fprintln(os.Stderr, "The deleted context was the current context, no context is current now")
+	}
+}
+
+// removeContext deletes the named context from every kubeconfig file defining it, together with its cluster
+// and user unless keepOrphans is set or another context of any kubeconfig file references them. merged is
+// updated accordingly. It returns the names of the deleted cluster and user, or "".
+func removeContext(merged *Kubeconfig, name string, keepOrphans bool) (string, string, error) {
+	ctx := merged.context(name)
+	if ctx == nil {
+		return "", "", fmt.Errorf("no context named %q", name)
+	}
+	var orphanCluster, orphanUser string
+	if !keepOrphans {
+		orphanCluster, orphanUser = ctx.Cluster, ctx.AuthInfo
+		for _, c := range merged.Contexts {
+			if c.Name == name {
+				continue
+			}
+			if c.Context.Cluster == orphanCluster {
+				orphanCluster = ""
+			}
+			if c.Context.AuthInfo == orphanUser {
+				orphanUser = ""
+			}
+		}
+	}
+
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return "", "", err
+	}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if !kc.deleteContext(name, orphanCluster, orphanUser) {
+			continue
+		}
+		if err := writeKubeconfigWithBackup(path, kc); err != nil {
+			return "", "", err
+		}
+	}
+	merged.deleteContext(name, orphanCluster, orphanUser)
+	return orphanCluster, orphanUser, nil
+}
+
+// runKubeconfigRenameContext implements `kubeconfig rename-context`
+func runKubeconfigRenameContext(args []string) {
+	renameCmd := flag.NewFlagSet("rename-context", flag.ExitOnError)
+	renameEntries := renameCmd.Bool("rename-entries", false, "Also rename the cluster and user of the context, updating all contexts referencing them")
+	renameCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig rename-context [--rename-entries] OLD NEW")
+		renameCmd.PrintDefaults()
+	}
+	if err := renameCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if renameCmd.NArg() != 2 {
+		renameCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	oldName, newName := renameCmd.Arg(0), renameCmd.Arg(1)
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := merged.context(oldName)
+	if ctx == nil {
+		fmt.Fprintf(os.Stderr, "no context named %q\n", oldName)
+		os.Exit(exitUsage)
+	}
+	if oldName == newName {
+		return
+	}
+	if merged.context(newName) != nil {
+		fmt.Fprintf(os.Stderr, "context %q already exists\n", newName)
+		os.Exit(exitUsage)
+	}
+	var oldCluster, oldUser string
+	if *renameEntries {
+		oldCluster, oldUser = ctx.Cluster, ctx.AuthInfo
+		if oldCluster != newName && merged.cluster(newName) != nil {
+			fmt.Fprintf(os.Stderr, "cluster %q already exists\n", newName)
+			os.Exit(exitUsage)
+		}
+		if oldUser != newName && merged.user(newName) != nil {
+			fmt.Fprintf(os.Stderr, "user %q already exists\n", newName)
+			os.Exit(exitUsage)
+		}
+	}
+
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		changed := kc.renameContext(oldName, newName)
+		if *renameEntries {
+			changed = kc.renameCluster(oldCluster, newName) || changed
+			changed = kc.renameUser(oldUser, newName) || changed
+		}
+		if !changed {
+			continue
+		}
+		if err := writeKubeconfigWithBackup(path, kc); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Printf("Context %q renamed to %q.\n", oldName, newName)
+}
+
+// runKubeconfigSetNamespace implements `kubeconfig set-namespace`
+func runKubeconfigSetNamespace(args []string) {
+	setNamespaceCmd := flag.NewFlagSet("set-namespace", flag.ExitOnError)
+	contextName := setNamespaceCmd.String("context", "", "Context to update, matched like use-context (default the current context)")
+	setNamespaceCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig set-namespace [--context NAME] NAMESPACE")
+		setNamespaceCmd.PrintDefaults()
+	}
+	// Allow flags after the namespace
+	var namespace string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		namespace, args = args[0], args[1:]
+	}
+	if err := setNamespaceCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if namespace == "" && setNamespaceCmd.NArg() == 1 {
+		namespace = setNamespaceCmd.Arg(0)
+	} else if namespace == "" || setNamespaceCmd.NArg() != 0 {
+		setNamespaceCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name := merged.CurrentContext
+	if *contextName != "" {
+		if name, err = matchContext(merged, *contextName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+	} else if name == "" {
+		fmt.Fprintln(os.Stderr, "no current context, use --context")
+		os.Exit(exitUsage)
+	}
+	if err := setContextNamespace(name, namespace); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set namespace: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Context %q now uses namespace %q.\n", name, namespace)
+}
+
+// setContextNamespace sets the namespace of the named context in the first kubeconfig file defining it
+func setContextNamespace(name, namespace string) error {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if ctx := kc.context(name); ctx != nil {
+			ctx.Namespace = namespace
+			return writeKubeconfigWithBackup(path, kc)
+		}
+	}
+	return fmt.Errorf("no context named %q", name)
+}
+
+// envNameRegex matches valid environment variable names
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// runKubeconfigSetExecEnv implements `kubeconfig set-exec-env`
+func runKubeconfigSetExecEnv(args []string) {
+	setEnvCmd := flag.NewFlagSet("set-exec-env", flag.ExitOnError)
+	setEnvCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig set-exec-env CONTEXT KEY=VALUE|KEY-...")
+		fmt.Fprintln(os.Stderr, "Sets, or with KEY- removes, env vars of the exec stanza of the context's user.")
+		setEnvCmd.PrintDefaults()
+	}
+	if err := setEnvCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if setEnvCmd.NArg() < 2 {
+		setEnvCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	var set []ExecEnvVar
+	var unset []string
+	for _, arg := range setEnvCmd.Args()[1:] {
+		name, value, isSet := strings.Cut(arg, "=")
+		if !isSet {
+			var isUnset bool
+			if name, isUnset = strings.CutSuffix(arg, "-"); !isUnset {
+				setEnvCmd.Usage()
+				os.Exit(exitUsage)
+			}
+		}
+		if !envNameRegex.MatchString(name) {
+			fmt.Fprintf(os.Stderr, "invalid env var name %q\n", name)
+			os.Exit(exitUsage)
+		}
+		if isSet {
+			set = append(set, ExecEnvVar{Name: name, Value: value})
+		} else {
+			unset = append(unset, name)
+		}
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name, err := matchContext(merged, setEnvCmd.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	userName := merged.context(name).AuthInfo
+	if user := merged.user(userName); user == nil || user.Exec == nil {
+		fmt.Fprintf(os.Stderr, "user %q of context %q has no exec stanza\n", userName, name)
+		os.Exit(exitUsage)
+	}
+	if err := setExecEnv(userName, set, unset); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set exec env: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Updated exec env of user %q.\n", userName)
+	var shared []string
+	for _, c := range merged.Contexts {
+		if c.Name != name && c.Context.AuthInfo == userName {
+			shared = append(shared, c.Name)
+		}
+	}
+	if len(shared) > 0 {
+		fmt.Fprintf(os.Stderr, "The user is shared with contexts %s, which are affected too\n", strings.Join(shared, ", "))
+	}
+}
+
+// setExecEnv sets and removes env vars of the exec stanza of the named user. Existing vars keep their
+// position.
+func setExecEnv(userName string, set []ExecEnvVar, unset []string) error {
+	_, err := updateUser(userName, func(user *AuthInfo) {
+		exec := user.Exec
+		for _, v := range set {
+			if i := slices.IndexFunc(exec.Env, func(e ExecEnvVar) bool { return e.Name == v.Name }); i >= 0 {
+				exec.Env[i].Value = v.Value
+			} else {
+				exec.Env = append(exec.Env, v)
+			}
+		}
+		exec.Env = slices.DeleteFunc(exec.Env, func(e ExecEnvVar) bool { return slices.Contains(unset, e.Name) })
+	})
+	return err
+}
+
+// updateUser applies update to the named user in the first kubeconfig file defining it and writes the file,
+// with a backup. It returns the path of the file.
+func updateUser(userName string, update func(user *AuthInfo)) (string, error) {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return "", err
+	}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if user := kc.user(userName); user != nil {
+			update(user)
+			return path, writeKubeconfigWithBackup(path, kc)
+		}
+	}
+	return "", fmt.Errorf("no user named %q", userName)
+}
+
+// runKubeconfigExport implements `kubeconfig export`
+func runKubeconfigExport(args []string) {
+	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
+	out := exportCmd.String("out", "", "Write the kubeconfig to this file (mode 0600) instead of stdout")
+	flatten := exportCmd.Bool("flatten", false, "Embed referenced certificate, key and token files")
+	exportCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig export [--out FILE] [--flatten] CONTEXT")
+		exportCmd.PrintDefaults()
+	}
+	// Allow flags after the context name
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := exportCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if name == "" && exportCmd.NArg() == 1 {
+		name = exportCmd.Arg(0)
+	} else if name == "" || exportCmd.NArg() != 0 {
+		exportCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name, err = matchContext(merged, name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	kc, err := exportContext(merged, name, *flatten)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export context: %v\n", err)
+		os.Exit(1)
+	}
+	if *out != "" {
+		if err := writeKubeconfig(*out, kc); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	data, err := yaml.Marshal(kc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to marshal kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := stdout.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// exportContext returns a kubeconfig holding only the named context with its cluster and user, as current
+// context. With flatten, files referenced by the cluster and user are embedded.
+func exportContext(merged *Kubeconfig, name string, flatten bool) (*Kubeconfig, error) {
+	ctx := merged.context(name)
+	kc := &Kubeconfig{
+		APIVersion:     "v1",
+		Kind:           "Config",
+		Contexts:       []NamedContext{{Name: name, Context: *ctx}},
+		CurrentContext: name,
+	}
+	if c := merged.cluster(ctx.Cluster); c != nil {
+		kc.Clusters = append(kc.Clusters, NamedCluster{Name: ctx.Cluster, Cluster: *c})
+	} else {
+		return nil, fmt.Errorf("cluster %q of context %q not found", ctx.Cluster, name)
+	}
+	if u := merged.user(ctx.AuthInfo); u != nil {
+		kc.Users = append(kc.Users, NamedUser{Name: ctx.AuthInfo, User: *u})
+	} else if ctx.AuthInfo != "" {
+		return nil, fmt.Errorf("user %q of context %q not found", ctx.AuthInfo, name)
+	}
+	if !flatten {
+		return kc, nil
+	}
+
+	if err := embedKubeconfigFiles(kc); err != nil {
+		return nil, err
+	}
+	return kc, nil
+}
+
+// embedKubeconfigFiles embeds the CA, client certificate, client key and token files referenced by the
+// clusters and users. Relative paths are relative to the kubeconfig file in effect defining the entry.
+func embedKubeconfigFiles(kc *Kubeconfig) error {
+	for i := range kc.Clusters {
+		c := &kc.Clusters[i]
+		if c.Cluster.CertificateAuthority == "" {
+			continue
+		}
+		dir, _, err := kubeconfigEntryDirs(c.Name, "")
+		if err != nil {
+			return err
+		}
+		if err := embedFile(&c.Cluster.CertificateAuthority, &c.Cluster.CertificateAuthorityData, dir, true); err != nil {
+			return err
+		}
+	}
+	for i := range kc.Users {
+		u := &kc.Users[i]
+		if u.User.ClientCertificate == "" && u.User.ClientKey == "" && u.User.TokenFile == "" {
+			continue
+		}
+		_, dir, err := kubeconfigEntryDirs("", u.Name)
+		if err != nil {
+			return err
+		}
+		if err := embedFile(&u.User.ClientCertificate, &u.User.ClientCertificateData, dir, true); err != nil {
+			return err
+		}
+		if err := embedFile(&u.User.ClientKey, &u.User.ClientKeyData, dir, true); err != nil {
+			return err
+		}
+		if err := embedFile(&u.User.TokenFile, &u.User.Token, dir, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// embedFile replaces a file reference by the file content, base64 encoded if encode is set
+func embedFile(path, data *string, dir string, encode bool) error {
+	if *path == "" {
+		return nil
+	}
+	p := *path
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	content, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if encode {
+		*data = base64.StdEncoding.EncodeToString(content)
+	} else {
+		*data = strings.TrimSpace(string(content))
+	}
+	*path = ""
+	return nil
+}
+
+// clusterCAFile returns the certificate-authority file of the named cluster entry. A relative path is
+// relative to the kubeconfig file in effect defining the entry, as for kubectl.
+func clusterCAFile(name string, cluster Cluster) (string, error) {
+	if filepath.IsAbs(cluster.CertificateAuthority) {
+		return cluster.CertificateAuthority, nil
+	}
+	dir, _, err := kubeconfigEntryDirs(name, "")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, cluster.CertificateAuthority), nil
+}
+
+// kubeconfigEntryDirs returns the directories of the kubeconfig files defining the named cluster and user
+func kubeconfigEntryDirs(cluster, user string) (string, string, error) {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return "", "", err
+	}
+	var clusterDir, userDir string
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		if clusterDir == "" && kc.cluster(cluster) != nil {
+			clusterDir = filepath.Dir(path)
+		}
+		if userDir == "" && kc.user(user) != nil {
+			userDir = filepath.Dir(path)
+		}
+	}
+	return clusterDir, userDir, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// currentFields are the fields available to the `kubeconfig current --format` template
+type currentFields struct {
+	Context   string
+	Namespace string
+	// Cluster is the EKS cluster name if known, else the name of the cluster entry
+	Cluster string
+	Account string
+	Region  string
+	User    string
+	Server  string
+}
+
+// runKubeconfigCurrent implements `kubeconfig current`. It runs in shell prompts, so it only reads the
+// kubeconfig and never loads AWS configuration or talks to AWS.
+func runKubeconfigCurrent(args []string) {
+	currentCmd := flag.NewFlagSet("current", flag.ExitOnError)
+	format := currentCmd.String("format", "{{.Context}}:{{.Namespace}}", "Go template rendering the current context, with fields Context, Namespace, Cluster, Account, Region, User and Server")
+	if err := currentCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if currentCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig current [--format TEMPLATE]")
+		os.Exit(exitUsage)
+	}
+	tmpl, err := template.New("current").Option("missingkey=error").Parse(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --format: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	kc, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	var fields *currentFields
+	for _, r := range contextRecords(kc) {
+		if r.Current {
+			fields = &currentFields{
+				Context:   r.Name,
+				Namespace: namespaceOrDefault(r.Namespace),
+				Cluster:   cmp.Or(r.Cluster.EKSCluster, r.Cluster.Name),
+				Account:   r.Cluster.Account,
+				Region:    r.Cluster.Region,
+				User:      r.User.Name,
+				Server:    r.Cluster.Server,
+			}
+		}
+	}
+	if fields == nil {
+		fmt.Fprintln(os.Stderr, "No current context")
+		os.Exit(1)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, fields); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --format: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	fmt.Println(out.String())
+}
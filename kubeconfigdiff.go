@@ -0,0 +1,200 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+)
+
+// runKubeconfigDiff implements `kubeconfig diff`
+func runKubeconfigDiff(args []string) {
+	diffCmd := flag.NewFlagSet("diff", flag.ExitOnError)
+	exitCodeFlag := diffCmd.Bool("exit-code", false, "Exit with 1 if the kubeconfigs differ")
+	diffCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig diff [--exit-code] [OLD] NEW, either may be - for stdin")
+		fmt.Fprintln(os.Stderr, "With a single file, the kubeconfig in effect is compared to it.")
+		diffCmd.PrintDefaults()
+	}
+	if err := diffCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if diffCmd.NArg() == 2 && diffCmd.Arg(0) == "-" && diffCmd.Arg(1) == "-" {
+		fmt.Fprintln(os.Stderr, "- for stdin may only be given once")
+		os.Exit(exitUsage)
+	}
+	var oldKC, newKC *Kubeconfig
+	var err error
+	switch diffCmd.NArg() {
+	case 1:
+		if oldKC, err = loadKubeconfig(); err == nil {
+			newKC, err = readKubeconfig(diffCmd.Arg(0))
+		}
+	case 2:
+		if oldKC, err = readKubeconfig(diffCmd.Arg(0)); err == nil {
+			newKC, err = readKubeconfig(diffCmd.Arg(1))
+		}
+	default:
+		diffCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+
+	lines := diffKubeconfigs(oldKC, newKC)
+	for _, l := range lines {
+		fmt.Println(l)
+	}
+	if *exitCodeFlag && len(lines) > 0 {
+		os.Exit(exitFailure)
+	}
+}
+
+// diffKubeconfigs compares two kubeconfigs entry by entry and returns the differences as diff-style lines:
+// "+" added, "-" removed and "~" changed entries, the latter followed by their changed fields
+func diffKubeconfigs(oldKC, newKC *Kubeconfig) []string {
+	var lines []string
+	lines = append(lines, diffEntries("cluster", clusterEntries(oldKC), clusterEntries(newKC))...)
+	lines = append(lines, diffEntries("user", userEntries(oldKC), userEntries(newKC))...)
+	lines = append(lines, diffEntries("context", contextEntries(oldKC), contextEntries(newKC))...)
+	if oldKC.CurrentContext != newKC.CurrentContext {
+		lines = append(lines, fmt.Sprintf("~ current-context %s -> %s", orDash(oldKC.CurrentContext), orDash(newKC.CurrentContext)))
+	}
+	return lines
+}
+
+// namedEntry is a cluster, user or context of a kubeconfig
+type namedEntry struct {
+	name  string
+	value any
+}
+
+func clusterEntries(kc *Kubeconfig) []namedEntry {
+	var entries []namedEntry
+	for _, c := range kc.Clusters {
+		entries = append(entries, namedEntry{c.Name, c.Cluster})
+	}
+	return entries
+}
+
+func userEntries(kc *Kubeconfig) []namedEntry {
+	var entries []namedEntry
+	for _, u := range kc.Users {
+		entries = append(entries, namedEntry{u.Name, u.User})
+	}
+	return entries
+}
+
+func contextEntries(kc *Kubeconfig) []namedEntry {
+	var entries []namedEntry
+	for _, c := range kc.Contexts {
+		entries = append(entries, namedEntry{c.Name, c.Context})
+	}
+	return entries
+}
+
+// diffEntries compares entries of one kind in the order of the old entries, followed by added ones
+func diffEntries(kind string, oldEntries, newEntries []namedEntry) []string {
+	var lines []string
+	for _, o := range oldEntries {
+		i := slices.IndexFunc(newEntries, func(n namedEntry) bool { return n.name == o.name })
+		if i < 0 {
+			lines = append(lines, fmt.Sprintf("- %-8s %s", kind, o.name))
+			continue
+		}
+		if fields := diffFields(o.value, newEntries[i].value); len(fields) > 0 {
+			lines = append(lines, fmt.Sprintf("~ %-8s %s", kind, o.name))
+			lines = append(lines, fields...)
+		}
+	}
+	for _, n := range newEntries {
+		if !slices.ContainsFunc(oldEntries, func(o namedEntry) bool { return o.name == n.name }) {
+			lines = append(lines, fmt.Sprintf("+ %-8s %s", kind, n.name))
+		}
+	}
+	return lines
+}
+
+// diffFields returns the fields differing between two entries, one indented line each with the dotted
+// field path and the old and new value
+func diffFields(oldEntry, newEntry any) []string {
+	oldFields, newFields := flattenEntry(oldEntry), flattenEntry(newEntry)
+	paths := map[string]bool{}
+	for p := range oldFields {
+		paths[p] = true
+	}
+	for p := range newFields {
+		paths[p] = true
+	}
+	var sorted []string
+	for p := range paths {
+		if oldFields[p] != newFields[p] {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, p := range sorted {
+		lines = append(lines, fmt.Sprintf("    %s: %s -> %s", p, orDash(oldFields[p]), orDash(newFields[p])))
+	}
+	return lines
+}
+
+// flattenEntry maps the dotted paths of the fields of an entry, as serialized into the kubeconfig, to
+// their JSON values. Lists of objects are indexed, e.g. exec.env[0].value; other lists are a single value.
+func flattenEntry(entry any) map[string]string {
+	fields := map[string]string{}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fields
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fields
+	}
+	var flatten func(prefix string, v any)
+	flatten = func(prefix string, v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			for k, child := range v {
+				if prefix != "" {
+					k = prefix + "." + k
+				}
+				flatten(k, child)
+			}
+			return
+		case []any:
+			if len(v) > 0 {
+				if _, ok := v[0].(map[string]any); ok {
+					for i, child := range v {
+						flatten(prefix+"["+strconv.Itoa(i)+"]", child)
+					}
+					return
+				}
+			}
+		}
+		data, _ := json.Marshal(v)
+		fields[prefix] = string(data)
+	}
+	flatten("", v)
+	return fields
+}
+
+// cloneKubeconfig returns a deep copy of a kubeconfig, to compare it with after changes
+func cloneKubeconfig(kc *Kubeconfig) *Kubeconfig {
+	var clone Kubeconfig
+	data, err := json.Marshal(kc)
+	if err == nil {
+		err = json.Unmarshal(data, &clone)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("failed to copy kubeconfig: %v", err))
+	}
+	return &clone
+}
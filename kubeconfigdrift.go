@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Drift check results of kubeconfig check-drift
+const (
+	driftOK    = "ok"
+	driftStale = "drift"
+	driftFixed = "fixed"
+	driftError = "error"
+)
+
+// clusterDrift is the difference between a kubeconfig cluster entry and the live EKS cluster
+type clusterDrift struct {
+	context string
+	cluster string
+	status  string
+	// live holds the endpoint and CA reported by EKS for the drifted fields, others are empty
+	live    Cluster
+	details []string
+}
+
+// runKubeconfigCheckDrift implements `kubeconfig check-drift`
+func runKubeconfigCheckDrift(g globalOptions, args []string) {
+	driftCmd := flag.NewFlagSet("check-drift", flag.ExitOnError)
+	fix := driftCmd.Bool("fix", false, "Update stale endpoints and CAs in place")
+	describeTimeout := driftCmd.Duration("describe-timeout", 10*time.Second, "Timeout for describing a single cluster")
+	if err := driftCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if driftCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig check-drift [--fix] [--describe-timeout DURATION]")
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	drifts := checkClusterDrift(ctx, g, merged, *describeTimeout)
+
+	stale := map[string]Cluster{}
+	failed := false
+	for _, d := range drifts {
+		switch d.status {
+		case driftStale:
+			stale[d.cluster] = d.live
+		case driftError:
+			failed = true
+		}
+	}
+	if *fix && len(stale) > 0 {
+		if err := fixClusterDrift(stale); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to update kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		for i := range drifts {
+			if drifts[i].status == driftStale {
+				drifts[i].status = driftFixed
+			}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTEXT\tCLUSTER\tSTATUS\tDETAIL")
+	for _, d := range drifts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.context, d.cluster, d.status, orDash(strings.Join(d.details, "; ")))
+	}
+	w.Flush()
+	if len(stale) > 0 && !*fix {
+		fmt.Fprintf(os.Stderr, "%d cluster entries are stale, use --fix to update them\n", len(stale))
+		os.Exit(1)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// checkClusterDrift compares the cluster entries of all EKS-backed contexts with DescribeCluster in
+// parallel, in kubeconfig order. A cluster entry shared by several contexts is checked once.
+func checkClusterDrift(ctx context.Context, g globalOptions, kc *Kubeconfig, timeout time.Duration) []clusterDrift {
+	var wg sync.WaitGroup
+	var drifts []clusterDrift
+	results := make([]*clusterDrift, len(kc.Contexts))
+	checked := map[string]bool{}
+	for i, c := range kc.Contexts {
+		entry := kc.cluster(c.Context.Cluster)
+		if entry == nil || checked[c.Context.Cluster] {
+			continue
+		}
+		t, isEKS, err := eksContextTarget(g, kc, c.Context)
+		if !isEKS {
+			continue
+		}
+		checked[c.Context.Cluster] = true
+		results[i] = &clusterDrift{context: c.Name, cluster: c.Context.Cluster}
+		if err != nil {
+			results[i].status, results[i].details = driftError, []string{err.Error()}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			describeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			compareClusterEntry(describeCtx, t, *entry, results[i])
+		}()
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r != nil {
+			drifts = append(drifts, *r)
+		}
+	}
+	return drifts
+}
+
+// compareClusterEntry describes the cluster of t and records the differences to the kubeconfig entry in d
+func compareClusterEntry(ctx context.Context, t tokenTarget, entry Cluster, d *clusterDrift) {
+	cfg, _, err := loadTargetConfig(ctx, getTokenOptions{}, t)
+	if err != nil {
+		d.status, d.details = driftError, []string{err.Error()}
+		return
+	}
+	_, live, err := describeKubeconfigCluster(ctx, cfg, t.cluster)
+	if err != nil {
+		d.status, d.details = driftError, []string{err.Error()}
+		return
+	}
+	d.status = driftOK
+	if entry.Server != live.Server {
+		d.status, d.live.Server = driftStale, live.Server
+		d.details = append(d.details, fmt.Sprintf("server %s -> %s", entry.Server, live.Server))
+	}
+	same, err := sameCA(d.cluster, entry, live.CertificateAuthorityData)
+	if err != nil {
+		d.status = driftError
+		d.details = append(d.details, err.Error())
+		return
+	}
+	if !same {
+		d.status, d.live.CertificateAuthorityData = driftStale, live.CertificateAuthorityData
+		d.details = append(d.details, "certificate authority changed")
+	}
+}
+
+// sameCA returns whether the CA of the named cluster entry, embedded or in a file, is the base64 encoded CA
+// data. An unreadable CA file is an error rather than drift.
+func sameCA(name string, entry Cluster, data string) (bool, error) {
+	want, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode EKS certificate authority: %w", err)
+	}
+	var have []byte
+	switch {
+	case entry.CertificateAuthorityData != "":
+		if have, err = base64.StdEncoding.DecodeString(entry.CertificateAuthorityData); err != nil {
+			// Garbage is as stale as an old CA
+			return false, nil
+		}
+	case entry.CertificateAuthority != "":
+		path, err := clusterCAFile(name, entry)
+		if err != nil {
+			return false, err
+		}
+		if have, err = os.ReadFile(path); err != nil {
+			return false, fmt.Errorf("failed to read certificate authority: %w", err)
+		}
+	}
+	return bytes.Equal(bytes.TrimSpace(have), bytes.TrimSpace(want)), nil
+}
+
+// fixClusterDrift updates the non-empty endpoint and CA fields of the named cluster entries, each in the
+// first kubeconfig file defining it. An updated CA is embedded, replacing a CA file reference.
+func fixClusterDrift(live map[string]Cluster) error {
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		return err
+	}
+	fixed := map[string]bool{}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		changed := false
+		for name, c := range live {
+			entry := kc.cluster(name)
+			if entry == nil || fixed[name] {
+				continue
+			}
+			if c.Server != "" {
+				entry.Server = c.Server
+			}
+			if c.CertificateAuthorityData != "" {
+				entry.CertificateAuthority = ""
+				entry.CertificateAuthorityData = c.CertificateAuthorityData
+			}
+			fixed[name], changed = true, true
+		}
+		if !changed {
+			continue
+		}
+		if err := writeKubeconfigWithBackup(path, kc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
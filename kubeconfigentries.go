@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// kubeconfigEntry is a cluster or user entry as listed by `kubeconfig get-clusters|get-users`
+type kubeconfigEntry struct {
+	name   string
+	detail string
+	// identity is compared to tell duplicated entries
+	identity any
+}
+
+// entryKind describes how `kubeconfig get-clusters|get-users` lists one kind of entry
+type entryKind struct {
+	header  string
+	entries func(kc *Kubeconfig) []kubeconfigEntry
+	// ref returns the name of the entry of this kind a context references
+	ref func(c Context) string
+}
+
+var clusterEntryKind = entryKind{
+	header: "SERVER",
+	entries: func(kc *Kubeconfig) []kubeconfigEntry {
+		var entries []kubeconfigEntry
+		for _, c := range kc.Clusters {
+			identity := [3]string{c.Cluster.Server, c.Cluster.CertificateAuthority, c.Cluster.CertificateAuthorityData}
+			entries = append(entries, kubeconfigEntry{name: c.Name, detail: c.Cluster.Server, identity: identity})
+		}
+		return entries
+	},
+	ref: func(c Context) string { return c.Cluster },
+}
+
+var userEntryKind = entryKind{
+	header: "AUTH",
+	entries: func(kc *Kubeconfig) []kubeconfigEntry {
+		var entries []kubeconfigEntry
+		for _, u := range kc.Users {
+			detail := authType(&u.User)
+			if exec, ok := parseGetTokenExec(u.User.Exec); ok {
+				detail = fmt.Sprintf("get-token (cluster %s)", exec.Cluster)
+			}
+			entries = append(entries, kubeconfigEntry{name: u.Name, detail: detail, identity: u.User})
+		}
+		return entries
+	},
+	ref: func(c Context) string { return c.AuthInfo },
+}
+
+// runKubeconfigGetEntries implements `kubeconfig get-clusters` and `kubeconfig get-users`
+func runKubeconfigGetEntries(command string, kind entryKind, args []string) {
+	getCmd := flag.NewFlagSet(command, flag.ExitOnError)
+	kubeconfigPath := getCmd.String("kubeconfig", "", "Kubeconfig file to list, or - for stdin (default the kubeconfig files in effect)")
+	if err := getCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if getCmd.NArg() != 0 {
+		fmt.Fprintf(os.Stderr, "Usage: kubeconfig %s [--kubeconfig FILE|-]\n", command)
+		os.Exit(exitUsage)
+	}
+
+	paths := []string{*kubeconfigPath}
+	if *kubeconfigPath == "" {
+		var err error
+		if paths, err = kubeconfigPaths(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to locate kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	merged := &Kubeconfig{}
+	files := map[string]*Kubeconfig{}
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		files[path] = kc
+		mergeKubeconfig(merged, kc)
+	}
+
+	refs := map[string]int{}
+	for _, c := range merged.Contexts {
+		refs[kind.ref(c.Context)]++
+	}
+	// Entries of later files with the name of an earlier one are shadowed, as with the merged view
+	definedIn := map[string]string{}
+	var effective []kubeconfigEntry
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "NAME\t%s\tCONTEXTS\tFILE\tNOTES\n", kind.header)
+	for _, path := range paths {
+		if files[path] == nil {
+			continue
+		}
+		for _, e := range kind.entries(files[path]) {
+			var notes []string
+			count := "-"
+			if file, shadowed := definedIn[e.name]; shadowed {
+				notes = append(notes, "shadowed by "+file)
+			} else {
+				definedIn[e.name] = path
+				count = strconv.Itoa(refs[e.name])
+				if refs[e.name] == 0 {
+					notes = append(notes, "unreferenced")
+				}
+				for _, other := range effective {
+					if reflect.DeepEqual(e.identity, other.identity) {
+						notes = append(notes, "same as "+other.name)
+					}
+				}
+				effective = append(effective, e)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", e.name, orDash(e.detail), count, path, orDash(strings.Join(notes, ", ")))
+		}
+	}
+	w.Flush()
+}
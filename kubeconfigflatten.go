@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"sigs.k8s.io/yaml"
+)
+
+// runKubeconfigFlatten implements `kubeconfig flatten`
+func runKubeconfigFlatten(args []string) {
+	flattenCmd := flag.NewFlagSet("flatten", flag.ExitOnError)
+	out := flattenCmd.String("out", "", "Write the kubeconfig to this file (mode 0600) instead of stdout")
+	minify := flattenCmd.Bool("minify", false, "Only keep the current context")
+	eksOnly := flattenCmd.Bool("eks-only", false, "Drop contexts not of EKS clusters")
+	if err := flattenCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if flattenCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig flatten [--out FILE] [--minify] [--eks-only]")
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	kc := cloneKubeconfig(merged)
+	kc.APIVersion, kc.Kind = "v1", "Config"
+	if *minify {
+		if merged.context(merged.CurrentContext) == nil {
+			fmt.Fprintln(os.Stderr, "no current context to minify to")
+			os.Exit(exitUsage)
+		}
+		kc.Contexts = slices.DeleteFunc(kc.Contexts, func(c NamedContext) bool { return c.Name != merged.CurrentContext })
+	}
+	if *eksOnly {
+		kc.Contexts = slices.DeleteFunc(kc.Contexts, func(c NamedContext) bool { return !isEKSContext(merged, c.Context) })
+	}
+	pruneUnreferenced(kc)
+	if err := embedKubeconfigFiles(kc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to embed files: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *out != "" {
+		if err := writeKubeconfig(*out, kc); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	data, err := yaml.Marshal(kc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to marshal kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := stdout.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// pruneUnreferenced drops the clusters and users no context references, and the current context if it
+// no longer exists
+func pruneUnreferenced(kc *Kubeconfig) {
+	kc.Clusters = slices.DeleteFunc(kc.Clusters, func(c NamedCluster) bool {
+		return !slices.ContainsFunc(kc.Contexts, func(ctx NamedContext) bool { return ctx.Context.Cluster == c.Name })
+	})
+	kc.Users = slices.DeleteFunc(kc.Users, func(u NamedUser) bool {
+		return !slices.ContainsFunc(kc.Contexts, func(ctx NamedContext) bool { return ctx.Context.AuthInfo == u.Name })
+	})
+	if kc.context(kc.CurrentContext) == nil {
+		kc.CurrentContext = ""
+	}
+}
+
+// isEKSContext reports whether a context is of an EKS cluster: its cluster is named by its ARN or has an EKS
+// endpoint, or its user gets tokens with `eks get-token` or aws-iam-authenticator
+func isEKSContext(kc *Kubeconfig, c Context) bool {
+	if arn.IsARN(c.Cluster) {
+		return true
+	}
+	if cluster := kc.cluster(c.Cluster); cluster != nil && eksRegionFromServer(cluster.Server) != "" {
+		return true
+	}
+	if user := kc.user(c.AuthInfo); user != nil {
+		if _, ok := parseGetTokenExec(user.Exec); ok || authType(user) == "iam-authenticator" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Conflict resolutions of kubeconfig merge, for entries named like an existing but different entry
+const (
+	mergeFail      = ""
+	mergeOverwrite = "overwrite"
+	mergeSkip      = "skip"
+	mergeRename    = "rename"
+)
+
+// runKubeconfigMerge implements `kubeconfig merge`
+func runKubeconfigMerge(args []string) {
+	mergeCmd := flag.NewFlagSet("merge", flag.ExitOnError)
+	into := mergeCmd.String("into", "", "Kubeconfig file to merge into (default the first file of $KUBECONFIG, else ~/.kube/config)")
+	overwrite := mergeCmd.Bool("overwrite", false, "Replace existing entries with conflicting ones of the same name")
+	skipExisting := mergeCmd.Bool("skip-existing", false, "Keep existing entries and drop conflicting ones of the same name")
+	renameOnConflict := mergeCmd.Bool("rename-on-conflict", false, "Add conflicting entries under a new name, NAME-2, NAME-3, ...")
+	dryRun := mergeCmd.Bool("dry-run", false, "Only print the changes to the target kubeconfig, field by field")
+	mergeCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig merge [flags] FILE|-...")
+		mergeCmd.PrintDefaults()
+	}
+	if err := mergeCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if mergeCmd.NArg() == 0 {
+		mergeCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if len(slices.DeleteFunc(slices.Clone(mergeCmd.Args()), func(a string) bool { return a != "-" })) > 1 {
+		fmt.Fprintln(os.Stderr, "- for stdin may only be given once")
+		os.Exit(exitUsage)
+	}
+	if *into == "-" {
+		fmt.Fprintln(os.Stderr, "--into must be a file")
+		os.Exit(exitUsage)
+	}
+	mode := mergeFail
+	for _, m := range []struct {
+		set  bool
+		mode string
+	}{{*overwrite, mergeOverwrite}, {*skipExisting, mergeSkip}, {*renameOnConflict, mergeRename}} {
+		if !m.set {
+			continue
+		}
+		if mode != mergeFail {
+			fmt.Fprintln(os.Stderr, "at most one of --overwrite, --skip-existing and --rename-on-conflict may be given")
+			os.Exit(exitUsage)
+		}
+		mode = m.mode
+	}
+
+	// The files to merge are combined first, the first file defining an entry winning like with KUBECONFIG
+	src := &Kubeconfig{}
+	for _, path := range mergeCmd.Args() {
+		kc, err := readKubeconfig(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		mergeKubeconfig(src, kc)
+	}
+
+	target := *into
+	if target == "" {
+		paths, err := kubeconfigPaths()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to locate kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		target = paths[0]
+	}
+	dst, err := readKubeconfig(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		dst, err = &Kubeconfig{APIVersion: "v1", Kind: "Config"}, nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+
+	before := cloneKubeconfig(dst)
+	changes, err := mergeInto(dst, src, mode)
+	if err != nil || !*dryRun {
+		for _, c := range changes {
+			fmt.Println(c)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if *dryRun {
+		for _, c := range diffKubeconfigs(before, dst) {
+			fmt.Println(c)
+		}
+		return
+	}
+	if err := writeKubeconfigWithBackup(target, dst); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// mergeInto merges the clusters, users and contexts of src into dst, resolving conflicts according to mode,
+// and returns the changes as diff-style lines: "+" added, "~" overwritten, "=" kept. With mode mergeFail,
+// conflicts are returned as error and dst must not be written.
+func mergeInto(dst, src *Kubeconfig, mode string) ([]string, error) {
+	var changes, conflicts []string
+	// resolve decides on an entry of src; it returns the name to store it under, or "" to drop it
+	resolve := func(kind, name string, entry, existing any, exists bool) string {
+		if !exists {
+			changes = append(changes, fmt.Sprintf("+ %-8s %s", kind, name))
+			return name
+		}
+		if sameEntry(entry, existing) {
+			changes = append(changes, fmt.Sprintf("= %-8s %s (unchanged)", kind, name))
+			return ""
+		}
+		switch mode {
+		case mergeOverwrite:
+			changes = append(changes, fmt.Sprintf("~ %-8s %s (overwritten)", kind, name))
+			return name
+		case mergeSkip:
+			changes = append(changes, fmt.Sprintf("= %-8s %s (kept existing)", kind, name))
+			return ""
+		case mergeRename:
+			renamed := freeName(name, func(n string) bool {
+				switch kind {
+				case "cluster":
+					return dst.cluster(n) != nil || src.cluster(n) != nil
+				case "user":
+					return dst.user(n) != nil || src.user(n) != nil
+				}
+				return dst.context(n) != nil || src.context(n) != nil
+			})
+			changes = append(changes, fmt.Sprintf("+ %-8s %s (renamed from %s)", kind, renamed, name))
+			return renamed
+		}
+		conflicts = append(conflicts, kind+" "+name)
+		return ""
+	}
+
+	clusterNames := map[string]string{}
+	for _, c := range src.Clusters {
+		existing := dst.cluster(c.Name)
+		if name := resolve("cluster", c.Name, c.Cluster, existing, existing != nil); name != "" {
+			clusterNames[c.Name] = name
+		}
+	}
+	userNames := map[string]string{}
+	for _, u := range src.Users {
+		existing := dst.user(u.Name)
+		if name := resolve("user", u.Name, u.User, existing, existing != nil); name != "" {
+			userNames[u.Name] = name
+		}
+	}
+	type contextChange struct {
+		name string
+		ctx  Context
+	}
+	var contexts []contextChange
+	for _, c := range src.Contexts {
+		// Contexts follow renamed clusters and users
+		ctx := c.Context
+		if name, ok := clusterNames[ctx.Cluster]; ok {
+			ctx.Cluster = name
+		}
+		if name, ok := userNames[ctx.AuthInfo]; ok {
+			ctx.AuthInfo = name
+		}
+		existing := dst.context(c.Name)
+		if name := resolve("context", c.Name, ctx, existing, existing != nil); name != "" {
+			contexts = append(contexts, contextChange{name, ctx})
+		}
+	}
+	if len(conflicts) > 0 {
+		return changes, fmt.Errorf("conflicting entries: %s; use --overwrite, --skip-existing or --rename-on-conflict", strings.Join(conflicts, ", "))
+	}
+
+	for _, c := range src.Clusters {
+		if name, ok := clusterNames[c.Name]; ok {
+			dst.putCluster(name, c.Cluster)
+		}
+	}
+	for _, u := range src.Users {
+		if name, ok := userNames[u.Name]; ok {
+			dst.setUser(name, u.User)
+		}
+	}
+	for _, c := range contexts {
+		if existing := dst.context(c.name); existing != nil {
+			*existing = c.ctx
+		} else {
+			dst.Contexts = append(dst.Contexts, NamedContext{Name: c.name, Context: c.ctx})
+		}
+	}
+	return changes, nil
+}
+
+// putCluster adds the named cluster, or replaces an existing one entirely
+func (kc *Kubeconfig) putCluster(name string, c Cluster) {
+	if existing := kc.cluster(name); existing != nil {
+		*existing = c
+		return
+	}
+	kc.Clusters = append(kc.Clusters, NamedCluster{Name: name, Cluster: c})
+}
+
+// sameEntry reports whether an entry equals an existing one, given by pointer
+func sameEntry(entry, existing any) bool {
+	a, errA := json.Marshal(entry)
+	b, errB := json.Marshal(existing)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
+
+// freeName returns name-2, name-3, ... whichever is the first not taken
+func freeName(name string, taken func(string) bool) string {
+	for i := 2; ; i++ {
+		if candidate := fmt.Sprintf("%s-%d", name, i); !taken(candidate) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// runKubeconfigMigrate implements `kubeconfig migrate`
+func runKubeconfigMigrate(args []string) {
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dryRun := migrateCmd.Bool("dry-run", false, "Only print the changes to each kubeconfig file")
+	if err := migrateCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if migrateCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig migrate [--dry-run]")
+		os.Exit(exitUsage)
+	}
+
+	paths, err := kubeconfigPaths()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to locate kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	migrated := 0
+	for _, path := range paths {
+		kc, err := readKubeconfig(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		before := cloneKubeconfig(kc)
+		var notes []string
+		for i := range kc.Users {
+			u := &kc.Users[i]
+			exec, dropped, ok := migrateExec(u.User.Exec)
+			if !ok {
+				continue
+			}
+			if !*dryRun {
+				fmt.Printf("~ user %s (%s)\n", u.Name, path)
+				fmt.Printf("  - %s\n", execCommandLine(u.User.Exec))
+				fmt.Printf("  + %s\n", execCommandLine(exec))
+			}
+			if len(dropped) > 0 {
+				notes = append(notes, fmt.Sprintf("! user %s: dropped unsupported arguments: %s", u.Name, strings.Join(dropped, " ")))
+			}
+			u.User.Exec = exec
+			migrated++
+		}
+		changes := diffKubeconfigs(before, kc)
+		if len(changes) == 0 {
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("--- %s\n", path)
+			for _, c := range changes {
+				fmt.Println(c)
+			}
+		}
+		for _, n := range notes {
+			fmt.Println(n)
+		}
+		if *dryRun {
+			continue
+		}
+		if err := writeKubeconfigWithBackup(path, kc); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if migrated == 0 {
+		fmt.Fprintln(os.Stderr, "No users with 'aws eks get-token' or 'aws-iam-authenticator token' exec stanzas found")
+	}
+}
+
+// migrateExec converts an exec stanza running `aws eks get-token` or `aws-iam-authenticator token` to one
+// running this tool with the same cluster, region, profile and role. The env is kept as is. It returns the
+// new stanza and the source arguments without equivalent, or false if the stanza is not of either kind.
+func migrateExec(e *ExecConfig) (*ExecConfig, []string, bool) {
+	if e == nil {
+		return nil, nil, false
+	}
+	// Flags with a value, mapped to the flags of this tool; "" drops the flag and its value
+	var valueFlags map[string]string
+	var switches []string
+	command := strings.TrimSuffix(filepath.Base(e.Command), ".exe")
+	switch {
+	case command == "aws" && slices.Contains(e.Args, "eks") && slices.Contains(e.Args, "get-token"):
+		valueFlags = map[string]string{"--cluster-name": "--cluster-name", "--cluster-id": "--cluster-id", "--region": "--region",
+			"--profile": "--profile", "--role-arn": "--role-arn", "--output": ""}
+		switches = []string{"eks", "get-token"}
+	case command == "aws-iam-authenticator" && slices.Contains(e.Args, "token"):
+		// The authenticator's cluster ID is the x-k8s-aws-id header value, which is the cluster name unless
+		// the cluster was set up with another ID
+		valueFlags = map[string]string{"-i": "--cluster-id", "--cluster-id": "--cluster-id", "-r": "--role-arn",
+			"--role": "--role-arn", "--region": "--region"}
+		switches = []string{"token"}
+	default:
+		return nil, nil, false
+	}
+
+	values := map[string]string{}
+	var dropped []string
+	for i := 0; i < len(e.Args); i++ {
+		arg := e.Args[i]
+		if slices.Contains(switches, arg) {
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		target, known := valueFlags[name]
+		if !known {
+			dropped = append(dropped, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(e.Args) {
+			i++
+			value = e.Args[i]
+		}
+		if target != "" {
+			values[target] = value
+		}
+	}
+	if values["--cluster-name"] == "" {
+		// Without a cluster name, e.g. for aws-iam-authenticator, the cluster ID stands in for it
+		values["--cluster-name"] = values["--cluster-id"]
+	}
+	if values["--cluster-name"] == "" {
+		// Nothing to mint a token for, leave the stanza alone
+		return nil, nil, false
+	}
+
+	migrated := *e
+	migrated.Command = execCommand
+	migrated.Args = nil
+	for _, global := range []string{"--region", "--profile"} {
+		if values[global] != "" {
+			migrated.Args = append(migrated.Args, global, values[global])
+		}
+	}
+	migrated.Args = append(migrated.Args, "eks", "get-token")
+	for _, flag := range []string{"--cluster-name", "--cluster-id", "--role-arn"} {
+		if values[flag] != "" {
+			migrated.Args = append(migrated.Args, flag, values[flag])
+		}
+	}
+	if !slices.Contains(execAPIVersions, migrated.APIVersion) {
+		migrated.APIVersion = execAPIVersionV1beta1
+	}
+	if migrated.InteractiveMode == "" {
+		migrated.InteractiveMode = "IfAvailable"
+	}
+	return &migrated, dropped, true
+}
+
+// execCommandLine renders an exec stanza as command line, with its env prepended
+func execCommandLine(e *ExecConfig) string {
+	var parts []string
+	for _, env := range e.Env {
+		parts = append(parts, env.Name+"="+env.Value)
+	}
+	parts = append(parts, e.Command)
+	return strings.Join(append(parts, e.Args...), " ")
+}
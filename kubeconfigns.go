@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// runKubeconfigNamespace implements `kubeconfig ns`
+func runKubeconfigNamespace(g globalOptions, args []string) {
+	nsCmd := flag.NewFlagSet("ns", flag.ExitOnError)
+	nsCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig ns [NAMESPACE]")
+		nsCmd.PrintDefaults()
+	}
+	if err := nsCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if nsCmd.NArg() > 1 {
+		nsCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	kc, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name := kc.CurrentContext
+	current := kc.context(name)
+	if current == nil {
+		fmt.Fprintln(os.Stderr, "no current context, use 'kubeconfig use-context' first")
+		os.Exit(exitUsage)
+	}
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	namespaces, err := listNamespaces(ctx, g, kc, current)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list namespaces: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+
+	namespace := nsCmd.Arg(0)
+	switch {
+	case namespace != "":
+		if !slices.Contains(namespaces, namespace) {
+			fmt.Fprintf(os.Stderr, "no namespace named %q in context %q\n", namespace, name)
+			os.Exit(exitUsage)
+		}
+	case !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())):
+		// Like kubens, list the namespaces when not run interactively
+		for _, ns := range namespaces {
+			fmt.Println(ns)
+		}
+		return
+	default:
+		var rows [][]string
+		for _, ns := range namespaces {
+			rows = append(rows, []string{ns})
+		}
+		namespace, err = pickRow([]string{"NAMESPACE"}, rows, namespaceOrDefault(current.Namespace))
+		if errors.Is(err, errSwitchCanceled) {
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read selection: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if err := setContextNamespace(name, namespace); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set namespace: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Context %q now uses namespace %q.\n", name, namespace)
+}
+
+// namespaceOrDefault returns the namespace, or "default" if none is set like kubectl assumes
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return "default"
+	}
+	return namespace
+}
+
+// listNamespaces lists the namespaces of the cluster of the context. Users running `eks get-token` are
+// authenticated with a token of this tool, served from the token cache if possible, others with their
+// static token.
+func listNamespaces(ctx context.Context, g globalOptions, kc *Kubeconfig, c *Context) ([]string, error) {
+	cluster := kc.cluster(c.Cluster)
+	if cluster == nil {
+		return nil, fmt.Errorf("cluster %q not found", c.Cluster)
+	}
+	user := kc.user(c.AuthInfo)
+	if user == nil {
+		return nil, fmt.Errorf("user %q not found", c.AuthInfo)
+	}
+	token, err := userToken(ctx, g, user)
+	if err != nil {
+		return nil, err
+	}
+	if cluster.CertificateAuthority != "" {
+		resolved := *cluster
+		if resolved.CertificateAuthority, err = clusterCAFile(c.Cluster, *cluster); err != nil {
+			return nil, err
+		}
+		cluster = &resolved
+	}
+	client, err := clusterHTTPClient(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(cluster.Server, "/")+"/api/v1/namespaces", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API server returned %s", resp.Status)
+	}
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse namespace list: %w", err)
+	}
+	var names []string
+	for _, item := range list.Items {
+		names = append(names, item.Metadata.Name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// userToken returns a bearer token for the user: minted by this tool for `eks get-token` exec stanzas, or
+// the user's static token
+func userToken(ctx context.Context, g globalOptions, user *AuthInfo) (string, error) {
+	if exec, ok := parseGetTokenExec(user.Exec); ok {
+		t, err := execTokenTarget(g, exec)
+		if err != nil {
+			return "", err
+		}
+		return bearerToken(ctx, t)
+	}
+	if user.Token != "" {
+		return user.Token, nil
+	}
+	if user.TokenFile != "" {
+		data, err := os.ReadFile(user.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", errors.New("the user neither runs 'eks get-token' nor has a token")
+}
+
+// bearerToken returns a token of this tool for the target, served from the token cache if possible
+func bearerToken(ctx context.Context, t tokenTarget) (string, error) {
+	opts := getTokenOptions{
+		tokenDuration:  maxTokenDuration,
+		cachePadding:   cacheExpiryPadding,
+		execAPIVersion: execAPIVersionV1beta1,
+	}
+	if settings.CacheExpiryPadding != nil {
+		opts.cachePadding = time.Duration(*settings.CacheExpiryPadding)
+	}
+	t.cachePadding = opts.cachePadding
+	data, _, err := getToken(ctx, opts, t)
+	if err != nil {
+		return "", err
+	}
+	var cred ExecCredential
+	if err := json.Unmarshal(data, &cred); err != nil {
+		return "", fmt.Errorf("failed to parse ExecCredential: %w", err)
+	}
+	return cred.Status.Token, nil
+}
+
+// clusterHTTPClient returns an HTTP client for the API server of the cluster, trusting its CA
+func clusterHTTPClient(cluster *Cluster) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         cluster.TLSServerName,
+		InsecureSkipVerify: cluster.InsecureSkipTLSVerify,
+	}
+	var ca []byte
+	switch {
+	case cluster.CertificateAuthorityData != "":
+		var err error
+		if ca, err = base64.StdEncoding.DecodeString(cluster.CertificateAuthorityData); err != nil {
+			return nil, fmt.Errorf("invalid certificate-authority-data: %w", err)
+		}
+	case cluster.CertificateAuthority != "":
+		var err error
+		if ca, err = os.ReadFile(cluster.CertificateAuthority); err != nil {
+			return nil, err
+		}
+	}
+	if ca != nil {
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificates in the cluster CA")
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if cluster.ProxyURL != "" {
+		proxy, err := url.Parse(cluster.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy-url: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{Transport: transport}, nil
+}
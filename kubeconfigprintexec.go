@@ -0,0 +1,80 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// runKubeconfigPrintExec implements `kubeconfig print-exec`
+func runKubeconfigPrintExec(g globalOptions, args []string) {
+	printExecCmd := flag.NewFlagSet("print-exec", flag.ExitOnError)
+	cluster := printExecCmd.String("cluster-name", "", "EKS cluster name or ARN (required)")
+	clusterID := printExecCmd.String("cluster-id", "", "Value for the x-k8s-aws-id header, for aws-iam-authenticator clusters")
+	roleARN := printExecCmd.String("role-arn", "", "IAM role to assume before signing the token")
+	userName := printExecCmd.String("user-name", "", "Name of the user entry (default the cluster name)")
+	absolutePath := printExecCmd.Bool("absolute-path", false, "Run this binary by its absolute path instead of looking it up in PATH")
+	apiVersion := printExecCmd.String("exec-api-version", "v1beta1", "ExecCredential apiVersion, v1 or v1beta1")
+	printExecCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig print-exec --cluster-name NAME [flags]")
+		fmt.Fprintln(os.Stderr, "Prints a kubeconfig user entry running `eks get-token` of this tool, for the global --region and --profile.")
+		printExecCmd.PrintDefaults()
+	}
+	if err := printExecCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if printExecCmd.NArg() != 0 || *cluster == "" {
+		printExecCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	t, err := newTokenTarget(g, *cluster, *clusterID)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	t.roleARN = *roleARN
+	// The stanza must not depend on the environment of whoever runs kubectl, so the region is spelled out
+	region := cmp.Or(t.region, os.Getenv("AWS_REGION"))
+	if region == "" {
+		fmt.Fprintln(os.Stderr, "--region is required unless --cluster-name is an ARN")
+		os.Exit(exitUsage)
+	}
+	if len(t.profiles) > 1 {
+		fmt.Fprintf(os.Stderr, "An exec stanza takes a single profile, pick one of %s with --profile\n", strings.Join(t.profiles, ", "))
+		os.Exit(exitUsage)
+	}
+
+	user := execAuthInfo(region, t.profiles[0], t)
+	if t.clusterID != t.cluster {
+		user.Exec.Args = append(user.Exec.Args, "--cluster-id", t.clusterID)
+	}
+	switch *apiVersion {
+	case "v1":
+		user.Exec.APIVersion = execAPIVersionV1
+	case "v1beta1":
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid --exec-api-version %q, must be v1 or v1beta1\n", *apiVersion)
+		os.Exit(exitUsage)
+	}
+	if *absolutePath {
+		if user.Exec.Command, err = os.Executable(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to locate this binary: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	data, err := yaml.Marshal([]NamedUser{{Name: cmp.Or(*userName, t.cluster), User: user}})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to marshal user: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := stdout.Write(data); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
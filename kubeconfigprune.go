@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+	"golang.org/x/term"
+)
+
+// Probe results of kubeconfig prune
+const (
+	probeOK          = "ok"
+	probeDeleted     = "deleted"
+	probeUnreachable = "unreachable"
+	probeUnknown     = "unknown"
+)
+
+// clusterProbe is the result of probing the cluster of a context
+type clusterProbe struct {
+	context string
+	status  string
+	detail  string
+}
+
+// runKubeconfigPrune implements `kubeconfig prune`
+func runKubeconfigPrune(g globalOptions, args []string) {
+	pruneCmd := flag.NewFlagSet("prune", flag.ExitOnError)
+	yes := pruneCmd.Bool("yes", false, "Remove the contexts without asking")
+	unreachable := pruneCmd.Bool("include-unreachable", false, "Also remove contexts whose API server cannot be reached")
+	probeTimeout := pruneCmd.Duration("probe-timeout", 5*time.Second, "Timeout for probing a single cluster")
+	if err := pruneCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if pruneCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig prune [--yes] [--include-unreachable] [--probe-timeout DURATION]")
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	probes := probeClusters(ctx, g, merged, *probeTimeout)
+
+	var prune []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTEXT\tSTATUS\tDETAIL")
+	for _, p := range probes {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.context, p.status, orDash(p.detail))
+		if p.status == probeDeleted || (p.status == probeUnreachable && *unreachable) {
+			prune = append(prune, p.context)
+		}
+	}
+	w.Flush()
+	if len(prune) == 0 {
+		fmt.Fprintln(os.Stderr, "No contexts to prune")
+		return
+	}
+
+	if !*yes {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			fmt.Fprintf(os.Stderr, "%d contexts to prune, use --yes to remove them without a terminal\n", len(prune))
+			os.Exit(exitInteractionRequired)
+		}
+		fmt.Fprintf(os.Stderr, "Remove %d contexts (%s)? [y/N] ", len(prune), strings.Join(prune, ", "))
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if a := strings.ToLower(strings.TrimSpace(answer)); a != "y" && a != "yes" {
+			return
+		}
+	}
+	for _, name := range prune {
+		cluster, user, err := removeContext(merged, name, false)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete context %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Deleted context %q.\n", name)
+		if cluster != "" {
+			fmt.Printf("Deleted cluster %q.\n", cluster)
+		}
+		if user != "" {
+			fmt.Printf("Deleted user %q.\n", user)
+		}
+	}
+}
+
+// probeClusters probes the clusters of all EKS-backed contexts in parallel, in kubeconfig order
+func probeClusters(ctx context.Context, g globalOptions, kc *Kubeconfig, timeout time.Duration) []clusterProbe {
+	var wg sync.WaitGroup
+	var probes []clusterProbe
+	results := make([]*clusterProbe, len(kc.Contexts))
+	for i, c := range kc.Contexts {
+		t, isEKS, err := eksContextTarget(g, kc, c.Context)
+		if !isEKS {
+			continue
+		}
+		results[i] = &clusterProbe{context: c.Name}
+		if err != nil {
+			results[i].status, results[i].detail = probeUnknown, err.Error()
+			continue
+		}
+		var server string
+		if cluster := kc.cluster(c.Context.Cluster); cluster != nil {
+			server = cluster.Server
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			results[i].status, results[i].detail = probeCluster(probeCtx, t, server)
+		}()
+	}
+	wg.Wait()
+	for _, r := range results {
+		if r != nil {
+			probes = append(probes, *r)
+		}
+	}
+	return probes
+}
+
+// eksContextTarget returns the EKS cluster of a context, or false if the context is not EKS-backed. Contexts
+// whose user runs `eks get-token` or whose cluster is named by its ARN are EKS-backed.
+func eksContextTarget(g globalOptions, kc *Kubeconfig, c Context) (tokenTarget, bool, error) {
+	if user := kc.user(c.AuthInfo); user != nil {
+		if exec, ok := parseGetTokenExec(user.Exec); ok {
+			t, err := execTokenTarget(g, exec)
+			return t, true, err
+		}
+	}
+	if arn.IsARN(c.Cluster) {
+		t, err := newTokenTarget(g, c.Cluster, "")
+		return t, true, err
+	}
+	return tokenTarget{}, false, nil
+}
+
+// probeCluster tells whether the cluster still exists with DescribeCluster. If that is not possible, e.g.
+// for lack of credentials, the /livez endpoint of the API server tells whether it is still reachable.
+func probeCluster(ctx context.Context, t tokenTarget, server string) (string, string) {
+	cfg, _, err := loadTargetConfig(ctx, getTokenOptions{}, t)
+	if err == nil {
+		_, err = eks.NewFromConfig(cfg).DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(t.cluster)})
+		var notFound *types.ResourceNotFoundException
+		switch {
+		case err == nil:
+			return probeOK, ""
+		case errors.As(err, &notFound):
+			return probeDeleted, fmt.Sprintf("cluster %s not found in %s", t.cluster, cfg.Region)
+		}
+	}
+	if server == "" {
+		return probeUnknown, err.Error()
+	}
+	logger.Debug("Probing API server", "cluster", t.cluster, "server", server, "error", err)
+	if livezErr := probeLivez(ctx, server); livezErr != nil {
+		return probeUnreachable, livezErr.Error()
+	}
+	return probeOK, "API server reachable"
+}
+
+// probeLivez requests /livez of an API server. Any HTTP response, even unauthorized, means it is reachable.
+func probeLivez(ctx context.Context, server string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(server, "/")+"/livez", nil)
+	if err != nil {
+		return err
+	}
+	// The cluster CA is irrelevant for telling whether the server is there
+	client, err := clusterHTTPClient(&Cluster{InsecureSkipTLSVerify: true})
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// runKubeconfigShell implements `kubeconfig shell`
+func runKubeconfigShell(args []string) {
+	shellCmd := flag.NewFlagSet("shell", flag.ExitOnError)
+	namespace := shellCmd.String("namespace", "", "Default namespace in the shell (default the context's namespace)")
+	shellCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig shell [--namespace NS] CONTEXT")
+		fmt.Fprintln(os.Stderr, "Starts $SHELL with KUBECONFIG set to a temporary kubeconfig holding only the context.")
+		shellCmd.PrintDefaults()
+	}
+	// Allow flags after the context name
+	var name string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if err := shellCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if name == "" && shellCmd.NArg() == 1 {
+		name = shellCmd.Arg(0)
+	} else if name == "" || shellCmd.NArg() != 0 {
+		shellCmd.Usage()
+		os.Exit(exitUsage)
+	}
+
+	merged, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	name, err = matchContext(merged, name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	// Flattened, as relative file references would not resolve from the temporary directory
+	kc, err := exportContext(merged, name, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to export context: %v\n", err)
+		os.Exit(1)
+	}
+	if *namespace != "" {
+		kc.Contexts[0].Context.Namespace = *namespace
+	}
+	code, err := runEphemeralShell(kc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to run shell: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+// runEphemeralShell writes kc to a private temporary directory and runs $SHELL with KUBECONFIG pointing at
+// it, so changes of the context in the shell stay there. The directory is removed when the shell exits.
+// It returns the exit code of the shell.
+func runEphemeralShell(kc *Kubeconfig) (int, error) {
+	dir, err := os.MkdirTemp("", "eks-get-token-shell-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := writeKubeconfig(path, kc); err != nil {
+		return 0, err
+	}
+
+	shell := cmp.Or(os.Getenv("SHELL"), "/bin/sh")
+	cmd := exec.Command(shell)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = append(os.Environ(), "KUBECONFIG="+path)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGHUP, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	fmt.Fprintf(os.Stderr, "Starting %s with context %q, exit the shell to leave it\n", shell, kc.CurrentContext)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	go func() {
+		for sig := range signals {
+			// Ctrl-C is for the shell, this process has to stay around to clean up
+			if sig == os.Interrupt {
+				continue
+			}
+			// A closed terminal or a kill must not leave the kubeconfig, with any embedded secrets, behind
+			cmd.Process.Signal(sig)
+			os.RemoveAll(dir)
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		}
+	}()
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
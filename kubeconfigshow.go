@@ -0,0 +1,585 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// contextRecord is a context as listed by `kubeconfig show --output json|yaml`
+type contextRecord struct {
+	Name      string        `json:"name"`
+	Current   bool          `json:"current"`
+	Namespace string        `json:"namespace,omitempty"`
+	Cluster   clusterRecord `json:"cluster"`
+	User      userRecord    `json:"user"`
+	// Token is the cached token of users running this tool's get-token
+	Token *tokenRecord `json:"token,omitempty"`
+}
+
+// clusterRecord is the cluster of a context, with the EKS cluster name, account and region if known
+type clusterRecord struct {
+	Name string `json:"name"`
+	// NotFound is set if the context references a cluster missing from the kubeconfig
+	NotFound   bool   `json:"notFound,omitempty"`
+	Server     string `json:"server,omitempty"`
+	EKSCluster string `json:"eksCluster,omitempty"`
+	Account    string `json:"account,omitempty"`
+	Region     string `json:"region,omitempty"`
+}
+
+// userRecord is the user of a context, with its detected auth mechanism
+type userRecord struct {
+	Name string `json:"name"`
+	// NotFound is set if the context references a user missing from the kubeconfig
+	NotFound bool   `json:"notFound,omitempty"`
+	Auth     string `json:"auth,omitempty"`
+}
+
+// tokenRecord is the state of a cached token: fresh, expired or none
+type tokenRecord struct {
+	Status string `json:"status"`
+	Expiry string `json:"expiry,omitempty"`
+}
+
+// String returns the token status as shown in the table, e.g. "fresh (12m left)"
+func (r *tokenRecord) String() string {
+	if r == nil {
+		return "-"
+	}
+	if r.Status != "fresh" {
+		return r.Status
+	}
+	expiry, err := time.Parse(time.RFC3339, r.Expiry)
+	if err != nil {
+		return r.Status
+	}
+	return fmt.Sprintf("fresh (%dm left)", int(time.Until(expiry).Round(time.Minute).Minutes()))
+}
+
+// runKubeconfigShow implements `kubeconfig show`
+func runKubeconfigShow(args []string) {
+	showCmd := flag.NewFlagSet("show", flag.ExitOnError)
+	kubeconfigPath := showCmd.String("kubeconfig", "", "Kubeconfig file to show, or - for stdin (default the kubeconfig in effect)")
+	output := showCmd.String("output", "", "Output format, 'wide' for a table with server, namespace and auth columns, 'json' or 'yaml' (default a table)")
+	showCmd.StringVar(output, "o", "", "Shorthand for --output")
+	var filter showFilter
+	showCmd.StringVar(&filter.cluster, "cluster", "", "Only show contexts whose cluster entry or EKS cluster name matches this glob")
+	showCmd.StringVar(&filter.user, "user", "", "Only show contexts whose user matches this glob")
+	showCmd.StringVar(&filter.context, "context", "", "Only show contexts whose name matches this glob")
+	showCmd.BoolVar(&filter.current, "current", false, "Only show the current context")
+	sortBy := showCmd.String("sort-by", "", "Sort the contexts by 'name', 'cluster', 'account' or 'region' (default kubeconfig order)")
+	noColor := showCmd.Bool("no-color", false, "Disable colors, which are used if stdout is a terminal and NO_COLOR is not set")
+	groupBy := showCmd.String("group-by", "", "Show the contexts as a tree grouped by 'account' and region, or by 'region' and account")
+	columns := showCmd.String("columns", "", "Comma-separated table columns, of "+strings.Join(showColumnNames(), ", ")+" (default depends on --output)")
+	if err := showCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if showCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig show [flags]")
+		os.Exit(exitUsage)
+	}
+	if err := filter.compile(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if *output != "" && *output != "wide" && *output != "json" && *output != "yaml" {
+		fmt.Fprintln(os.Stderr, "--output must be 'wide', 'json' or 'yaml'")
+		os.Exit(exitUsage)
+	}
+	if *sortBy != "" && !slices.Contains([]string{"name", "cluster", "account", "region"}, *sortBy) {
+		fmt.Fprintln(os.Stderr, "--sort-by must be 'name', 'cluster', 'account' or 'region'")
+		os.Exit(exitUsage)
+	}
+	selected := defaultShowColumns
+	if *output == "wide" {
+		selected = wideShowColumns
+	}
+	if *columns != "" {
+		if *output == "json" || *output == "yaml" {
+			fmt.Fprintln(os.Stderr, "--columns cannot be combined with --output json or yaml")
+			os.Exit(exitUsage)
+		}
+		selected = strings.Split(*columns, ",")
+	}
+	if *groupBy != "" {
+		if *groupBy != "account" && *groupBy != "region" {
+			fmt.Fprintln(os.Stderr, "--group-by must be 'account' or 'region'")
+			os.Exit(exitUsage)
+		}
+		if *output != "" || *columns != "" {
+			fmt.Fprintln(os.Stderr, "--group-by cannot be combined with --output or --columns")
+			os.Exit(exitUsage)
+		}
+	}
+	table, err := selectShowColumns(selected)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+
+	kc, err := loadKubeconfigFrom(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	records := filter.apply(contextRecords(kc))
+	sortContextRecords(records, *sortBy)
+	addTokenRecords(context.Background(), kc, records)
+
+	switch *output {
+	case "json", "yaml":
+		// An empty list rather than null, so consumers need not special case it
+		if records == nil {
+			records = []contextRecord{}
+		}
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err == nil && *output == "yaml" {
+			data, err = yaml.JSONToYAML(data)
+		} else if err == nil {
+			data = append(data, '\n')
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format output: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(data); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	color := !*noColor && useColor(stdout)
+	if *groupBy != "" {
+		if _, err := stdout.WriteString(contextTree(records, *groupBy, color)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Colors are applied to the aligned lines, as tabwriter would count escape sequences as text
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	var headers []string
+	for _, c := range table {
+		headers = append(headers, c.header)
+	}
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, r := range records {
+		var cells []string
+		for _, c := range table {
+			cells = append(cells, c.value(r))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	w.Flush()
+	lines := strings.SplitAfter(buf.String(), "\n")
+	if color {
+		for i, r := range records {
+			line := strings.TrimSuffix(lines[i+1], "\n")
+			line = strings.ReplaceAll(line, notFoundMarker(true), colorRed+notFoundMarker(true)+colorReset)
+			if r.Current {
+				line = colorBold + colorGreen + strings.ReplaceAll(line, colorReset, colorReset+colorBold+colorGreen) + colorReset
+			}
+			lines[i+1] = line + "\n"
+		}
+	}
+	if _, err := stdout.WriteString(strings.Join(lines, "")); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// contextTree renders the records as a tree grouped by account, then region, or by region, then account.
+// Contexts keep their order within their group.
+func contextTree(records []contextRecord, groupBy string, color bool) string {
+	keys := func(r contextRecord) (string, string) {
+		account := cmp.Or(r.Cluster.Account, "unknown account")
+		region := cmp.Or(r.Cluster.Region, "unknown region")
+		if groupBy == "region" {
+			return region, account
+		}
+		return account, region
+	}
+	groups := map[string]map[string][]contextRecord{}
+	for _, r := range records {
+		outer, inner := keys(r)
+		if groups[outer] == nil {
+			groups[outer] = map[string][]contextRecord{}
+		}
+		groups[outer][inner] = append(groups[outer][inner], r)
+	}
+	// Unknown accounts and regions sort last
+	sortedKeys := func(keys []string) []string {
+		sort.Slice(keys, func(i, j int) bool {
+			if a, b := strings.HasPrefix(keys[i], "unknown "), strings.HasPrefix(keys[j], "unknown "); a != b {
+				return b
+			}
+			return keys[i] < keys[j]
+		})
+		return keys
+	}
+	branch := func(last bool) (string, string) {
+		if last {
+			return "└── ", "    "
+		}
+		return "├── ", "│   "
+	}
+
+	var b strings.Builder
+	for _, outer := range sortedKeys(slices.Collect(maps.Keys(groups))) {
+		b.WriteString(outer + "\n")
+		innerKeys := sortedKeys(slices.Collect(maps.Keys(groups[outer])))
+		for i, inner := range innerKeys {
+			prefix, indent := branch(i == len(innerKeys)-1)
+			b.WriteString(prefix + inner + "\n")
+			contexts := groups[outer][inner]
+			for j, r := range contexts {
+				leafPrefix, _ := branch(j == len(contexts)-1)
+				leaf := r.Name + " (cluster " + orDash(r.Cluster.EKSCluster, r.Cluster.Name) + notFoundMarker(r.Cluster.NotFound)
+				if r.Token != nil {
+					leaf += ", token " + r.Token.String()
+				}
+				leaf += ")"
+				if color {
+					leaf = strings.ReplaceAll(leaf, notFoundMarker(true), colorRed+notFoundMarker(true)+colorReset)
+				}
+				if r.Current {
+					leaf = "* " + leaf
+					if color {
+						leaf = colorBold + colorGreen + strings.ReplaceAll(leaf, colorReset, colorReset+colorBold+colorGreen) + colorReset
+					}
+				}
+				b.WriteString(indent + leafPrefix + leaf + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// showColumn is a table column of `kubeconfig show`
+type showColumn struct {
+	name   string
+	header string
+	value  func(contextRecord) string
+}
+
+// showColumns are the available table columns
+var showColumns = []showColumn{
+	{"current", "CURRENT", func(r contextRecord) string {
+		if r.Current {
+			return "*"
+		}
+		return ""
+	}},
+	{"name", "NAME", func(r contextRecord) string { return r.Name }},
+	{"cluster", "CLUSTER", func(r contextRecord) string {
+		return orDash(r.Cluster.EKSCluster, r.Cluster.Name) + notFoundMarker(r.Cluster.NotFound)
+	}},
+	{"account", "ACCOUNT", func(r contextRecord) string { return orDash(r.Cluster.Account) }},
+	{"region", "REGION", func(r contextRecord) string { return orDash(r.Cluster.Region) }},
+	{"user", "USER", func(r contextRecord) string { return orDash(r.User.Name) + notFoundMarker(r.User.NotFound) }},
+	{"status", "STATUS", func(r contextRecord) string { return r.Token.String() }},
+	{"server", "SERVER", func(r contextRecord) string { return orDash(r.Cluster.Server) }},
+	{"namespace", "NAMESPACE", func(r contextRecord) string { return orDash(r.Namespace) }},
+	{"auth", "AUTH", func(r contextRecord) string { return orDash(r.User.Auth) }},
+}
+
+// notFoundMarker marks references to missing kubeconfig entries
+func notFoundMarker(notFound bool) string {
+	if notFound {
+		return " (not found)"
+	}
+	return ""
+}
+
+// Default table columns, without and with --output wide
+var (
+	defaultShowColumns = []string{"current", "name", "cluster", "account", "region", "user", "status"}
+	wideShowColumns    = []string{"current", "name", "cluster", "account", "region", "user", "status", "server", "namespace", "auth"}
+)
+
+// showColumnNames returns the names of all table columns
+func showColumnNames() []string {
+	var names []string
+	for _, c := range showColumns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// selectShowColumns returns the named table columns in the given order
+func selectShowColumns(names []string) ([]showColumn, error) {
+	var columns []showColumn
+	for _, name := range names {
+		i := slices.IndexFunc(showColumns, func(c showColumn) bool { return c.name == strings.TrimSpace(name) })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown column %q, must be one of %s", name, strings.Join(showColumnNames(), ", "))
+		}
+		columns = append(columns, showColumns[i])
+	}
+	return columns, nil
+}
+
+// sortContextRecords sorts the records by name, cluster, account or region, then by name. With an empty key,
+// the kubeconfig order is kept.
+func sortContextRecords(records []contextRecord, key string) {
+	if key == "" {
+		return
+	}
+	sortKey := func(r contextRecord) string {
+		switch key {
+		case "cluster":
+			return orDash(r.Cluster.EKSCluster, r.Cluster.Name)
+		case "account":
+			return r.Cluster.Account
+		case "region":
+			return r.Cluster.Region
+		}
+		return r.Name
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if a, b := sortKey(records[i]), sortKey(records[j]); a != b {
+			return a < b
+		}
+		return records[i].Name < records[j].Name
+	})
+}
+
+// contextRecords describes the contexts of the kubeconfig in file order
+func contextRecords(kc *Kubeconfig) []contextRecord {
+	var records []contextRecord
+	for _, c := range kc.Contexts {
+		r := contextRecord{
+			Name:      c.Name,
+			Current:   c.Name == kc.CurrentContext,
+			Namespace: c.Context.Namespace,
+			Cluster:   clusterRecord{Name: c.Context.Cluster},
+			User:      userRecord{Name: c.Context.AuthInfo},
+		}
+		if cluster := kc.cluster(c.Context.Cluster); cluster != nil {
+			r.Cluster.Server = cluster.Server
+		} else {
+			r.Cluster.NotFound = true
+		}
+		r.Cluster.EKSCluster, r.Cluster.Account, r.Cluster.Region = eksClusterInfo(kc, c.Context.Cluster)
+		if user := kc.user(c.Context.AuthInfo); user != nil {
+			r.User.Auth = authType(user)
+			// An `eks get-token` exec stanza names the cluster, possibly by ARN, and region
+			if exec, ok := parseGetTokenExec(user.Exec); ok {
+				if parsed, err := parseClusterARN(exec.Cluster); err == nil {
+					exec.Cluster, exec.Region = parsed.Name, parsed.Region
+					r.Cluster.Account = cmp.Or(r.Cluster.Account, parsed.Account)
+				}
+				r.Cluster.EKSCluster = cmp.Or(r.Cluster.EKSCluster, exec.Cluster)
+				r.Cluster.Region = cmp.Or(r.Cluster.Region, exec.Region)
+			}
+		} else if c.Context.AuthInfo != "" {
+			r.User.NotFound = true
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// showFilter selects the contexts listed by `kubeconfig show`. Empty patterns match everything.
+type showFilter struct {
+	cluster string
+	user    string
+	context string
+	current bool
+
+	clusterRegex, userRegex, contextRegex *regexp.Regexp
+}
+
+// compile parses the glob patterns of the filter
+func (f *showFilter) compile() error {
+	for _, p := range []struct {
+		flag    string
+		pattern string
+		regex   **regexp.Regexp
+	}{{"cluster", f.cluster, &f.clusterRegex}, {"user", f.user, &f.userRegex}, {"context", f.context, &f.contextRegex}} {
+		if p.pattern == "" {
+			continue
+		}
+		regex, err := globRegexp(p.pattern)
+		if err != nil {
+			return fmt.Errorf("invalid --%s pattern %q: %w", p.flag, p.pattern, err)
+		}
+		*p.regex = regex
+	}
+	return nil
+}
+
+// apply returns the records matching the filter
+func (f showFilter) apply(records []contextRecord) []contextRecord {
+	match := func(regex *regexp.Regexp, values ...string) bool {
+		if regex == nil {
+			return true
+		}
+		for _, v := range values {
+			if v != "" && regex.MatchString(v) {
+				return true
+			}
+		}
+		return false
+	}
+	var matches []contextRecord
+	for _, r := range records {
+		if (f.current && !r.Current) || !match(f.contextRegex, r.Name) || !match(f.userRegex, r.User.Name) ||
+			!match(f.clusterRegex, r.Cluster.Name, r.Cluster.EKSCluster) {
+			continue
+		}
+		matches = append(matches, r)
+	}
+	return matches
+}
+
+// globRegexp translates a shell glob with *, ? and [...] classes to an anchored regexp. Unlike path.Match,
+// * also matches slashes, which separate the cluster name in cluster ARNs.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// addTokenRecords looks up the cached tokens of the contexts whose user runs `eks get-token` of this tool,
+// with the profile and region of its exec stanza
+func addTokenRecords(ctx context.Context, kc *Kubeconfig, records []contextRecord) {
+	var store tokenStore
+	for i := range records {
+		user := kc.user(records[i].User.Name)
+		if user == nil || user.Exec == nil || strings.TrimSuffix(filepath.Base(user.Exec.Command), ".exe") != execCommand {
+			continue
+		}
+		exec, ok := parseGetTokenExec(user.Exec)
+		if !ok {
+			continue
+		}
+		t, err := execTokenTarget(globalOptions{}, exec)
+		if err != nil {
+			logger.Debug("Cannot look up cached token", "context", records[i].Name, "error", err)
+			continue
+		}
+		if store == nil {
+			if store, err = newTokenStore(); err != nil {
+				logger.Warn("Failed to open token cache", "error", err)
+				return
+			}
+		}
+		records[i].Token = cachedTokenRecord(ctx, store, t)
+	}
+}
+
+// cachedTokenRecord returns the state of the cached token of the target, taking the first fresh token of its
+// profiles like get-token does
+func cachedTokenRecord(ctx context.Context, store tokenStore, t tokenTarget) *tokenRecord {
+	padding := cacheExpiryPadding
+	if settings.CacheExpiryPadding != nil {
+		padding = time.Duration(*settings.CacheExpiryPadding)
+	}
+	record := &tokenRecord{Status: "none"}
+	for _, profile := range t.profiles {
+		region := cacheRegion(ctx, getTokenOptions{}, t, profile)
+		if region == "" {
+			continue
+		}
+		key := tokenCacheKey{profile: profile, region: region, clusterID: t.clusterID, roleARN: t.roleARN}
+		data, err := store.load(ctx, key.name())
+		if err != nil {
+			continue
+		}
+		env, err := decodeCacheEntry(data)
+		if err != nil {
+			continue
+		}
+		if validCachedToken(env.Credential, padding, maxTokenDuration) {
+			return &tokenRecord{Status: "fresh", Expiry: env.Credential.Status.ExpirationTimestamp}
+		}
+		record = &tokenRecord{Status: "expired", Expiry: env.Credential.Status.ExpirationTimestamp}
+	}
+	return record
+}
+
+// authType names the auth mechanism of a user: aws-cli, iam-authenticator, oidc or exec for exec plugins,
+// the auth provider name, client-cert, token, basic, or none
+func authType(u *AuthInfo) string {
+	switch {
+	case u.Exec != nil:
+		command := strings.TrimSuffix(filepath.Base(u.Exec.Command), ".exe")
+		switch {
+		case command == "aws":
+			return "aws-cli"
+		case command == "aws-iam-authenticator":
+			return "iam-authenticator"
+		case command == "kubelogin" || slices.Contains(u.Exec.Args, "oidc-login"):
+			return "oidc"
+		}
+		return "exec"
+	case len(u.AuthProvider) > 0:
+		var provider struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(u.AuthProvider, &provider); err == nil && provider.Name != "" {
+			return provider.Name
+		}
+		return "auth-provider"
+	case u.ClientCertificate != "" || u.ClientCertificateData != "":
+		return "client-cert"
+	case u.Token != "" || u.TokenFile != "":
+		return "token"
+	case u.Username != "":
+		return "basic"
+	}
+	return "none"
+}
+
+// orDash returns the first non-empty value, or "-" for table cells without any
+func orDash(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return "-"
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"golang.org/x/term"
+)
+
+// switchVisibleRows is how many matching rows the switcher shows at once
+const switchVisibleRows = 10
+
+// errSwitchCanceled is returned when the switcher is left without selecting a context
+var errSwitchCanceled = errors.New("canceled")
+
+// contextRow is a context as listed by the switcher
+type contextRow struct {
+	name    string
+	cluster string
+	account string
+	region  string
+}
+
+// fields returns the columns of the row
+func (r contextRow) fields() []string {
+	return []string{r.name, r.cluster, r.account, r.region}
+}
+
+// runKubeconfigSwitch implements `kubeconfig switch`
+func runKubeconfigSwitch(args []string) {
+	switchCmd := flag.NewFlagSet("switch", flag.ExitOnError)
+	if err := switchCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprintln(os.Stderr, "kubeconfig switch requires a terminal, use 'kubeconfig use-context NAME' instead")
+		os.Exit(exitUsage)
+	}
+
+	kc, err := loadKubeconfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	rows := contextRows(kc)
+	if len(rows) == 0 {
+		fmt.Fprintln(os.Stderr, "No contexts in kubeconfig")
+		os.Exit(1)
+	}
+
+	name, err := pickContext(rows, kc.CurrentContext)
+	if errors.Is(err, errSwitchCanceled) {
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read selection: %v\n", err)
+		os.Exit(1)
+	}
+	if err := setCurrentContext(name); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set current context: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Switched to context %q.\n", name)
+}
+
+// contextRows lists the contexts with the EKS cluster name, account and region as found by eksClusterInfo
+func contextRows(kc *Kubeconfig) []contextRow {
+	var rows []contextRow
+	for _, c := range kc.Contexts {
+		cluster, account, region := eksClusterInfo(kc, c.Context.Cluster)
+		rows = append(rows, contextRow{name: c.Name, cluster: orDash(cluster, c.Context.Cluster), account: orDash(account), region: orDash(region)})
+	}
+	return rows
+}
+
+// eksClusterInfo returns the EKS cluster name, account and region of a kubeconfig cluster, taken from a
+// cluster ARN naming the cluster entry, as written by update-kubeconfig, or else the region of the EKS
+// endpoint. Unknown parts are empty.
+func eksClusterInfo(kc *Kubeconfig, name string) (cluster, account, region string) {
+	if arn.IsARN(name) {
+		if parsed, err := parseClusterARN(name); err == nil {
+			return parsed.Name, parsed.Account, parsed.Region
+		}
+	} else if c := kc.cluster(name); c != nil {
+		return "", "", eksRegionFromServer(c.Server)
+	}
+	return "", "", ""
+}
+
+// filterRows returns the rows with any column fuzzily matching filter, i.e. containing its characters in
+// order, ignoring case
+func filterRows(rows [][]string, filter string) [][]string {
+	var matches [][]string
+	for _, r := range rows {
+		if slices.ContainsFunc(r, func(f string) bool { return fuzzyMatch(f, filter) }) {
+			matches = append(matches, r)
+		}
+	}
+	return matches
+}
+
+// fuzzyMatch returns whether s contains the characters of pattern in order, ignoring case
+func fuzzyMatch(s, pattern string) bool {
+	s = strings.ToLower(s)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(s, r)
+		if i < 0 {
+			return false
+		}
+		s = s[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// pickContext lets the user pick one of the contexts, see pickRow
+func pickContext(rows []contextRow, current string) (string, error) {
+	var fields [][]string
+	for _, r := range rows {
+		fields = append(fields, r.fields())
+	}
+	return pickRow([]string{"CONTEXT", "CLUSTER", "ACCOUNT", "REGION"}, fields, current)
+}
+
+// pickRow lets the user filter the rows by typing and select one with the arrow keys and enter, returning
+// the first column of the selected row. The list is drawn on stderr, with the terminal in raw mode for the
+// duration.
+func pickRow(header []string, rows [][]string, current string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(fd, state)
+
+	widths := make([]int, len(header))
+	for _, r := range append([][]string{header}, rows...) {
+		for i, f := range r {
+			widths[i] = max(widths[i], len(f))
+		}
+	}
+	format := func(r []string) string {
+		cells := make([]string, len(r))
+		for i, f := range r {
+			if i < len(r)-1 {
+				f = fmt.Sprintf("%-*s", widths[i], f)
+			}
+			cells[i] = f
+		}
+		return strings.Join(cells, "  ")
+	}
+
+	filter := ""
+	selected := 0
+	for i, r := range rows {
+		if r[0] == current {
+			selected = i
+		}
+	}
+	buf := make([]byte, 64)
+	for {
+		matches := filterRows(rows, filter)
+		selected = min(max(selected, 0), max(len(matches)-1, 0))
+
+		// Redraw below the filter line, where the cursor is left after each drawing
+		var b strings.Builder
+		b.WriteString("\r\x1b[J")
+		fmt.Fprintf(&b, "> %s\r\n", filter)
+		fmt.Fprintf(&b, "  %s\r\n", format(header))
+		drawn := 2
+		first := max(0, selected-switchVisibleRows+1)
+		for i := first; i < len(matches) && i < first+switchVisibleRows; i++ {
+			if i == selected {
+				fmt.Fprintf(&b, "\x1b[7m> %s\x1b[0m\r\n", format(matches[i]))
+			} else {
+				fmt.Fprintf(&b, "  %s\r\n", format(matches[i]))
+			}
+			drawn++
+		}
+		fmt.Fprintf(&b, "\x1b[%dA\r\x1b[%dC", drawn, utf8.RuneCountInString(filter)+2)
+		fmt.Fprint(os.Stderr, b.String())
+
+		n, err := os.Stdin.Read(buf)
+		if err == io.EOF {
+			return "", errSwitchCanceled
+		}
+		if err != nil {
+			return "", err
+		}
+		switch key := string(buf[:n]); key {
+		case "\r", "\n":
+			fmt.Fprint(os.Stderr, "\r\x1b[J")
+			if len(matches) == 0 {
+				return "", errSwitchCanceled
+			}
+			return matches[selected][0], nil
+		case "\x03", "\x1b":
+			fmt.Fprint(os.Stderr, "\r\x1b[J")
+			return "", errSwitchCanceled
+		case "\x1b[A", "\x1bOA", "\x10":
+			selected--
+		case "\x1b[B", "\x1bOB", "\x0e":
+			selected++
+		case "\x7f", "\x08":
+			if filter != "" {
+				_, size := utf8.DecodeLastRuneInString(filter)
+				filter = filter[:len(filter)-size]
+				selected = 0
+			}
+		default:
+			if !strings.ContainsFunc(key, unicode.IsControl) {
+				filter += key
+				selected = 0
+			}
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Severities of kubeconfig validation findings
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// execAPIVersions are the exec credential API versions kubectl still supports
+var execAPIVersions = []string{execAPIVersionV1, execAPIVersionV1beta1}
+
+// validationFinding is a problem found by `kubeconfig validate`, with a hint how to fix it
+type validationFinding struct {
+	severity string
+	context  string
+	message  string
+	hint     string
+}
+
+// runKubeconfigValidate implements `kubeconfig validate`
+func runKubeconfigValidate(args []string) {
+	validateCmd := flag.NewFlagSet("validate", flag.ExitOnError)
+	kubeconfigPath := validateCmd.String("kubeconfig", "", "Kubeconfig file to validate, or - for stdin (default the kubeconfig in effect)")
+	if err := validateCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	switch {
+	case validateCmd.NArg() == 1 && *kubeconfigPath == "":
+		*kubeconfigPath = validateCmd.Arg(0)
+	case validateCmd.NArg() != 0:
+		fmt.Fprintln(os.Stderr, "Usage: kubeconfig validate [--kubeconfig] [FILE|-]")
+		os.Exit(exitUsage)
+	}
+
+	kc, err := loadKubeconfigFrom(*kubeconfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	findings := validateKubeconfig(kc)
+
+	errorCount := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(findings) > 0 {
+		fmt.Fprintln(w, "SEVERITY\tCONTEXT\tFINDING")
+	}
+	for _, f := range findings {
+		if f.severity == severityError {
+			errorCount++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s; %s\n", f.severity, orDash(f.context), f.message, f.hint)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "%d contexts checked, %d errors, %d warnings\n", len(kc.Contexts), errorCount, len(findings)-errorCount)
+	switch {
+	case errorCount > 0:
+		os.Exit(exitFailure)
+	case len(findings) > 0:
+		os.Exit(exitValidationWarnings)
+	}
+}
+
+// validateKubeconfig checks the contexts for dangling references and their users for broken exec stanzas
+func validateKubeconfig(kc *Kubeconfig) []validationFinding {
+	var findings []validationFinding
+	if kc.CurrentContext != "" && kc.context(kc.CurrentContext) == nil {
+		findings = append(findings, validationFinding{severityError, "", fmt.Sprintf("current context %q not found", kc.CurrentContext),
+			"select an existing one with 'kubeconfig use-context'"})
+	}
+	for _, c := range kc.Contexts {
+		add := func(severity, message, hint string) {
+			findings = append(findings, validationFinding{severity, c.Name, message, hint})
+		}
+		if kc.cluster(c.Context.Cluster) == nil {
+			add(severityError, fmt.Sprintf("cluster %q not found", c.Context.Cluster), "re-add it with 'eks update-kubeconfig' or remove the context with 'kubeconfig delete-context'")
+		}
+		user := kc.user(c.Context.AuthInfo)
+		if user == nil {
+			add(severityError, fmt.Sprintf("user %q not found", c.Context.AuthInfo), "re-add it with 'eks update-kubeconfig' or remove the context with 'kubeconfig delete-context'")
+			continue
+		}
+		if user.Exec != nil {
+			for _, f := range validateExec(user.Exec) {
+				add(f.severity, fmt.Sprintf("user %q: %s", c.Context.AuthInfo, f.message), f.hint)
+			}
+		}
+	}
+	return findings
+}
+
+// validateExec checks an exec stanza for a missing command and unsupported API version, and AWS token
+// stanzas for missing cluster, region and profile
+func validateExec(e *ExecConfig) []validationFinding {
+	var findings []validationFinding
+	add := func(severity, message, hint string) {
+		findings = append(findings, validationFinding{severity: severity, message: message, hint: hint})
+	}
+	if _, err := exec.LookPath(e.Command); err != nil {
+		add(severityError, fmt.Sprintf("exec command %q not found", e.Command), "install it or fix the command path")
+	}
+	switch {
+	case e.APIVersion == "":
+		add(severityError, "exec apiVersion missing", "set it to client.authentication.k8s.io/v1beta1")
+	case !slices.Contains(execAPIVersions, e.APIVersion):
+		add(severityError, fmt.Sprintf("exec apiVersion %s is not supported by current kubectl", e.APIVersion),
+			"set it to client.authentication.k8s.io/v1beta1")
+	}
+
+	command := strings.TrimSuffix(filepath.Base(e.Command), ".exe")
+	getToken := slices.Contains(e.Args, "eks") && slices.Contains(e.Args, "get-token")
+	authenticator := command == "aws-iam-authenticator" && slices.Contains(e.Args, "token")
+	if !getToken && !authenticator {
+		return findings
+	}
+	if getToken {
+		parsed, ok := parseGetTokenExec(e)
+		if !ok {
+			add(severityError, "eks get-token without --cluster-name", "add --cluster-name CLUSTER to the args")
+		} else if parsed.Region == "" {
+			add(severityWarning, "eks get-token without --region", "add --region REGION, else the profile's default region is signed for")
+		}
+	}
+	if authenticator && !slices.ContainsFunc(e.Args, func(arg string) bool {
+		return arg == "-i" || arg == "--cluster-id" || strings.HasPrefix(arg, "--cluster-id=")
+	}) {
+		add(severityError, "aws-iam-authenticator token without -i", "add -i CLUSTER to the args")
+	}
+	hasProfile := slices.ContainsFunc(e.Env, func(env ExecEnvVar) bool { return env.Name == "AWS_PROFILE" }) ||
+		slices.ContainsFunc(e.Args, func(arg string) bool { return arg == "--profile" || strings.HasPrefix(arg, "--profile=") })
+	if !hasProfile {
+		add(severityWarning, "no AWS_PROFILE in env", "add an AWS_PROFILE env entry, else the token depends on the shell's AWS_PROFILE")
+	}
+	return findings
+}
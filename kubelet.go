@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// kubeletCredentialProviderAPIVersion is the API version of kubelet credential provider responses
+const kubeletCredentialProviderAPIVersion = "credentialprovider.kubelet.k8s.io/v1"
+
+// kubeletAuthConfig is the credential the kubelet uses for images matching a key of the auth map
+type kubeletAuthConfig struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// kubeletCredentialProviderResponse is the response of a kubelet credential provider plugin
+type kubeletCredentialProviderResponse struct {
+	APIVersion    string                       `json:"apiVersion"`
+	Kind          string                       `json:"kind"`
+	CacheKeyType  string                       `json:"cacheKeyType"`
+	CacheDuration string                       `json:"cacheDuration,omitempty"`
+	Auth          map[string]kubeletAuthConfig `json:"auth"`
+}
+
+// kubeletResponse converts an ExecCredential to a CredentialProviderResponse for images matching match. The
+// token is the password; the kubelet caches it until padding before it expires.
+func kubeletResponse(cred ExecCredential, match string, padding time.Duration) ([]byte, error) {
+	resp := kubeletCredentialProviderResponse{
+		APIVersion:   kubeletCredentialProviderAPIVersion,
+		Kind:         "CredentialProviderResponse",
+		CacheKeyType: "Global",
+		Auth: map[string]kubeletAuthConfig{
+			match: {Username: "k8s-aws-v1", Password: cred.Status.Token},
+		},
+	}
+	if expiry, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp); err == nil {
+		if d := time.Until(expiry) - padding; d > 0 {
+			resp.CacheDuration = d.Truncate(time.Second).String()
+		}
+	}
+	return json.MarshalIndent(resp, "", "  ")
+}
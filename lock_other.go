@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// tryLockFile always succeeds on platforms without file locking
+func tryLockFile(*os.File) (bool, error) {
+	return true, nil
+}
+
+// unlockFile is a no-op on platforms without file locking
+func unlockFile(*os.File) error {
+	return nil
+}
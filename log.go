@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// logger writes diagnostics to stderr, as stdout is reserved for the credential. Only warnings are shown by
+// default; setupLogging adjusts the level.
+var logger = newLogger(slog.LevelWarn, "text")
+
+// logJSON is whether --log-format json was given, in which case failures are logged rather than printed
+var logJSON bool
+
+// newLogger returns a logger writing records at or above level to stderr, as lines of key=value pairs for
+// the "text" format or JSON objects for "json"
+func newLogger(level slog.Level, format string) *slog.Logger {
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			// The time is noise for a short-lived command read by a human
+			if len(groups) == 0 && a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+}
+
+// setupLogging sets the log level from the --verbose and --quiet global flags and the format from
+// --log-format. Verbosity 1 logs cache decisions, credential sources and region resolution, 2 and above adds
+// debug details. Quiet hides warnings.
+func setupLogging(verbosity int, quiet bool, format string) error {
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown log format %q, must be 'text' or 'json'", format)
+	}
+	level := slog.LevelWarn
+	switch {
+	case quiet:
+		level = slog.LevelError
+	case verbosity >= 2:
+		level = slog.LevelDebug
+	case verbosity == 1:
+		level = slog.LevelInfo
+	}
+	logger = newLogger(level, format)
+	logJSON = format == "json"
+	return nil
+}
+
+// logEvent writes a record to the log regardless of the log level, e.g. audit events sent to stderr
+func logEvent(msg string, attrs ...slog.Attr) error {
+	r := slog.NewRecord(time.Now(), slog.LevelInfo, msg, 0)
+	r.AddAttrs(attrs...)
+	return logger.Handler().Handle(context.Background(), r)
+}
@@ -2,236 +2,786 @@ package main
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"os/user"
-	"path/filepath"
+	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/aws/smithy-go/middleware"
-	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/jmespath/go-jmespath"
+	"sigs.k8s.io/yaml"
 )
 
-// ExecCredential is the format for kubectl ExecCredential
-type ExecCredential struct {
-	APIVersion string `json:"apiVersion"`
-	Kind       string `json:"kind"`
-	Status     struct {
-		ExpirationTimestamp string `json:"expirationTimestamp"`
-		Token               string `json:"token"`
-	} `json:"status"`
-}
-
 const (
 	// AWS EKS maximum token duration is 15 minutes (900 seconds)
 	maxTokenDuration   = 900 * time.Second
 	cacheExpiryPadding = 30 * time.Second
+	// Reported token expiry is this much earlier than the signed expiry to absorb latency between
+	// kubectl and the API server
+	tokenExpiryPadding = 10 * time.Second
+	defaultTimeout     = 30 * time.Second
 )
 
+// globalOptions are the flags given before the subcommand
+type globalOptions struct {
+	region   string
+	timeout  time.Duration
+	profiles []string
+}
+
+// getTokenOptions are the flags of `eks get-token` shared by all clusters a token is minted for
+type getTokenOptions struct {
+	output         string
+	kubeletMatch   string
+	outFile        string
+	secretName     string
+	namespace      string
+	tokenDuration  time.Duration
+	stsRegion      string
+	discoverRegion bool
+	clockSkew      time.Duration
+	maxClockSkew   time.Duration
+	noCache        bool
+	forceRefresh   bool
+	headers        []signedHeader
+	query          string
+	cachePadding   time.Duration
+	cacheJitter    time.Duration
+	dryRun         bool
+	machine        bool
+	showExpiry     bool
+	touchID        bool
+	execAPIVersion string
+}
+
+// tokenTarget is a cluster to mint a token for, with the region and profiles to use
+type tokenTarget struct {
+	// cluster is the bare EKS cluster name
+	cluster string
+	// clusterID is the x-k8s-aws-id header value the token is bound to
+	clusterID   string
+	region      string
+	regionGiven bool
+	profiles    []string
+	// roleARN is an IAM role assumed with the profile credentials before signing
+	roleARN string
+	// cachePadding is the --cache-expiry-padding for the cluster
+	cachePadding time.Duration
+	// server is the API server URL of a cluster known only by its endpoint, resolved to a cluster name
+	// by resolveEndpointTarget
+	server string
+}
+
 func main() {
-	region := flag.String("region", "", "AWS region (required)")
+	var g globalOptions
+	flag.StringVar(&g.region, "region", "", "AWS region (default $AWS_REGION, $AWS_DEFAULT_REGION or the profile's region)")
+	flag.DurationVar(&g.timeout, "timeout", defaultTimeout, "Timeout for all AWS operations (0 disables the timeout)")
+	flag.StringVar(&cacheDirFlag, "cache-dir", "", "Cache directory (default $EKS_GET_TOKEN_CACHE_DIR, $KUBECACHEDIR, or $XDG_CACHE_HOME/eks-get-token on Linux and ~/.kube/cache elsewhere)")
+	flag.Var((*stringSliceFlag)(&g.profiles), "profile", "AWS profile, may be repeated to try profiles in order (default $AWS_PROFILE)")
+	flag.StringVar(&cacheBackendFlag, "cache-backend", "", "Token cache backend, 'file', 'keyring', 'command' or 'dynamodb' (default 'file', or 'command' if cache commands are configured)")
+	flag.StringVar(&cacheAgeIdentityFlag, "cache-age-identity", "", "Encrypt the file token cache with the age identity in this file")
+	flag.StringVar(&cacheKMSKeyFlag, "cache-kms-key-arn", "", "Encrypt the file token cache with this KMS key")
+	flag.BoolVar(&fixPermissionsFlag, "fix-permissions", false, "Tighten insecure permissions of cache files and the cache directory instead of failing")
+	flag.StringVar(&auditLogFlag, "audit-log", "", "Append a JSON line for every issued token to this file, or 'syslog', or 'stderr' for the stderr log")
+	verbosity := flag.Int("verbose", 0, "Log verbosity on stderr, 1 for cache decisions, credential sources and region resolution, 2 for debug details")
+	flag.IntVar(verbosity, "v", 0, "Shorthand for --verbose")
+	quiet := flag.Bool("quiet", false, "Only log errors, no warnings")
+	logFormat := flag.String("log-format", "text", "Format of the stderr log, 'text' or 'json'")
+	configPath := flag.String("config", "", "Configuration file (default $XDG_CONFIG_HOME/eks-get-token/config.yaml)")
 	flag.Parse()
-	if *region == "" {
-		flag.Usage()
-		os.Exit(1)
+	if err := setupLogging(*verbosity, *quiet, *logFormat); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid --log-format: %v\n", err)
+		os.Exit(exitUsage)
 	}
 
 	args := flag.Args()
-	if len(args) < 2 || args[0] != "eks" || args[1] != "get-token" {
-		fmt.Fprintln(os.Stderr, "expected 'eks get-token' subcommand(s)")
-		os.Exit(1)
+	// Shell prompts run `kubeconfig current` all the time, it needs neither the configuration nor the cache
+	if len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "current" {
+		runKubeconfigCurrent(args[2:])
+		return
+	}
+
+	var err error
+	settings, err = loadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load configuration: %v\n", err)
+		os.Exit(exitUsage)
 	}
+	if _, err := newTokenStore(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid cache configuration: %v\n", err)
+		os.Exit(exitUsage)
+	}
+
+	switch {
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "get-token":
+		runGetToken(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "get-kubeconfig":
+		runGetKubeconfig(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "update-kubeconfig":
+		runUpdateKubeconfig(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "whoami":
+		runWhoami(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "list-access-entries":
+		runListAccessEntries(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "list-nodegroups":
+		runListNodegroups(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "describe-cluster":
+		runDescribeCluster(g, args[2:])
+	case len(args) >= 2 && args[0] == "eks" && args[1] == "list-clusters":
+		runListClusters(g, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "use-context":
+		runKubeconfigUseContext(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "delete-context":
+		runKubeconfigDeleteContext(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "rename-context":
+		runKubeconfigRenameContext(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "merge":
+		runKubeconfigMerge(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "print-exec":
+		runKubeconfigPrintExec(g, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "get-clusters":
+		runKubeconfigGetEntries(args[1], clusterEntryKind, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "get-users":
+		runKubeconfigGetEntries(args[1], userEntryKind, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "shell":
+		runKubeconfigShell(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "check-drift":
+		runKubeconfigCheckDrift(g, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "set-exec-env":
+		runKubeconfigSetExecEnv(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "flatten":
+		runKubeconfigFlatten(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "diff":
+		runKubeconfigDiff(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "prune":
+		runKubeconfigPrune(g, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "backup":
+		runKubeconfigBackup(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "ns":
+		runKubeconfigNamespace(g, args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "set-namespace":
+		runKubeconfigSetNamespace(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "migrate":
+		runKubeconfigMigrate(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "validate":
+		runKubeconfigValidate(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "show":
+		runKubeconfigShow(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "export":
+		runKubeconfigExport(args[2:])
+	case len(args) >= 2 && args[0] == "kubeconfig" && args[1] == "switch":
+		runKubeconfigSwitch(args[2:])
+	case len(args) >= 1 && args[0] == "doctor":
+		runDoctor(g, args[1:])
+	case len(args) >= 2 && args[0] == "server" && args[1] == "verify":
+		runServerVerify(g, args[2:])
+	case len(args) >= 2 && args[0] == "token" && args[1] == "verify":
+		runTokenVerify(g, args[2:])
+	case len(args) >= 2 && args[0] == "token" && args[1] == "decode":
+		runTokenDecode(args[2:])
+	case len(args) >= 2 && args[0] == "sts" && args[1] == "whoami":
+		runSTSWhoami(g, args[2:])
+	case len(args) >= 1 && args[0] == "install":
+		runInstall(g, args[1:])
+	case len(args) >= 2 && args[0] == "cache" && args[1] == "purge":
+		runCachePurge(args[2:])
+	case len(args) >= 2 && args[0] == "cache" && args[1] == "list":
+		runCacheList(args[2:])
+	case len(args) >= 2 && args[0] == "cache" && args[1] == "path":
+		runCachePath(g, args[2:])
+	case len(args) >= 2 && args[0] == "cache" && args[1] == "gc":
+		runCacheGC(args[2:])
+	case len(args) >= 2 && args[0] == "cache" && args[1] == "stats":
+		runCacheStats(args[2:])
+	default:
+		fmt.Fprintln(os.Stderr, "expected 'eks get-token|get-kubeconfig|update-kubeconfig|list-clusters|describe-cluster|list-nodegroups|list-access-entries|whoami', 'kubeconfig use-context|switch|current|rename-context|delete-context|merge|export|show|validate|migrate|set-namespace|ns|backup|prune|diff|flatten|set-exec-env|check-drift|shell|get-clusters|get-users|print-exec', 'cache purge|list|path|gc|stats', 'sts whoami', 'token decode|verify', 'server verify', 'doctor' or 'install' subcommand(s)")
+		os.Exit(exitUsage)
+	}
+}
 
-	flag.NewFlagSet("eks", flag.ExitOnError)
+// runGetToken implements `eks get-token`
+func runGetToken(g globalOptions, args []string) {
+	var opts getTokenOptions
+	var clusters stringSliceFlag
 	getTokenCmd := flag.NewFlagSet("get-token", flag.ExitOnError)
-	cluster := getTokenCmd.String("cluster-name", "", "EKS cluster name (required)")
-	output := getTokenCmd.String("output", "json", "Output format (must be 'json')")
-	err := getTokenCmd.Parse(args[2:])
+	getTokenCmd.Var(&clusters, "cluster-name", "EKS cluster name or ARN (required), may be repeated to mint tokens for several clusters")
+	roleARN := getTokenCmd.String("role-arn", "", "IAM role to assume before signing the token")
+	clusterID := getTokenCmd.String("cluster-id", "", "Value for the x-k8s-aws-id header, for aws-iam-authenticator clusters (default --cluster-name)")
+	allKubeconfigClusters := getTokenCmd.Bool("all-kubeconfig-clusters", false, "Mint tokens for all clusters with an 'eks get-token' exec stanza in the kubeconfig")
+	getTokenCmd.StringVar(&opts.output, "output", "json", "Output format, 'json', 'yaml', 'token' for the bare token, 'env' for shell exports, 'kubelet' for a kubelet CredentialProviderResponse, or 'secret' for a Secret manifest")
+	getTokenCmd.StringVar(&opts.secretName, "secret-name", "", "Name of the Secret rendered by --output secret")
+	getTokenCmd.StringVar(&opts.namespace, "namespace", "", "Namespace of the Secret rendered by --output secret")
+	getTokenCmd.StringVar(&opts.outFile, "out-file", "", "Write the output to this file (mode 0600) instead of stdout")
+	getTokenCmd.StringVar(&opts.kubeletMatch, "kubelet-match-image", "*", "Image pattern the token is returned for with --output kubelet")
+	getTokenCmd.DurationVar(&opts.tokenDuration, "token-duration", maxTokenDuration, "Token validity duration (max 15m)")
+	getTokenCmd.StringVar(&opts.stsRegion, "sts-region", "", "Region of the STS endpoint used for signing (default --region)")
+	getTokenCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	getTokenCmd.DurationVar(&opts.clockSkew, "clock-skew", 0, "Backdate the signing time by this much to tolerate a fast local clock")
+	getTokenCmd.DurationVar(&opts.maxClockSkew, "max-clock-skew", defaultMaxClockSkew, "Warn when the local clock is off AWS by more than this, checked when a token is minted for the cache (0 disables)")
+	getTokenCmd.BoolVar(&opts.noCache, "no-cache", false, "Always mint a fresh token and never read or write the token cache")
+	getTokenCmd.BoolVar(&opts.forceRefresh, "force-refresh", false, "Ignore any cached token and mint a new one, still updating the cache")
+	defaultPadding := cacheExpiryPadding
+	if settings.CacheExpiryPadding != nil {
+		defaultPadding = time.Duration(*settings.CacheExpiryPadding)
+	}
+	getTokenCmd.DurationVar(&opts.cachePadding, "cache-expiry-padding", defaultPadding, "Mint a new token once the cached one expires within this duration")
+	getTokenCmd.DurationVar(&opts.cacheJitter, "cache-expiry-jitter", 0, "Extend --cache-expiry-padding by a random duration up to this to spread out refreshes")
+	getTokenCmd.BoolVar(&opts.dryRun, "dry-run", false, "Print the caller identity, STS endpoint, signed headers and expiry instead of a token")
+	getTokenCmd.BoolVar(&opts.showExpiry, "show-expiry", false, "Print a one-line summary of identity, remaining validity and cache use of the token to stderr")
+	getTokenCmd.BoolVar(&opts.machine, "machine", false, "Guarantee that nothing but the complete credential is written to stdout (implied when run by kubectl)")
+	getTokenCmd.BoolVar(&opts.touchID, "touch-id", settings.TouchID, "Require Touch ID confirmation before releasing a token (macOS)")
+	execAPIVersion := getTokenCmd.String("exec-api-version", "", "ExecCredential apiVersion, v1 or v1beta1 (default the version announced in KUBERNETES_EXEC_INFO, else v1beta1)")
+	getTokenCmd.StringVar(&opts.query, "query", "", "JMESPath query applied to the output, e.g. status.token")
+	getTokenCmd.Func("header", "Additional `key=value` header signed into the token, may be repeated", func(s string) error {
+		h, err := parseSignedHeader(s)
+		if err != nil {
+			return err
+		}
+		opts.headers = append(opts.headers, h)
+		return nil
+	})
+	err := getTokenCmd.Parse(args)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
-	if *output != "json" {
-		fmt.Fprintln(os.Stderr, "only 'json' is accepted for --output")
-		os.Exit(1)
+	if opts.query != "" {
+		if _, err := jmespath.Compile(opts.query); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid --query: %v\n", err)
+			os.Exit(exitUsage)
+		}
 	}
-	if *cluster == "" {
-		getTokenCmd.Usage()
-		os.Exit(1)
+	allowPrompts, err = canPrompt()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read KUBERNETES_EXEC_INFO: %v\n", err)
+		os.Exit(exitUsage)
 	}
-
-	profile := os.Getenv("AWS_PROFILE")
-	if profile == "" {
-		fmt.Fprintln(os.Stderr, "AWS_PROFILE environment variable is required")
-		os.Exit(1)
+	opts.execAPIVersion, err = resolveExecAPIVersion(*execAPIVersion)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to determine the ExecCredential apiVersion: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if os.Getenv("KUBERNETES_EXEC_INFO") != "" {
+		opts.machine = true
+	}
+	if opts.machine {
+		if opts.dryRun {
+			fmt.Fprintln(os.Stderr, "--dry-run cannot be combined with --machine")
+			os.Exit(exitUsage)
+		}
+		enforceStdoutPurity()
+	}
+	switch opts.output {
+	case "json", "yaml":
+	case "token", "env", "kubelet", "secret":
+		if opts.query != "" || len(clusters) > 1 || *allKubeconfigClusters {
+			fmt.Fprintf(os.Stderr, "--output %s requires a single cluster and no --query\n", opts.output)
+			os.Exit(exitUsage)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "--output must be 'json', 'yaml', 'token', 'env', 'kubelet' or 'secret'")
+		os.Exit(exitUsage)
+	}
+	if (opts.output == "secret") != (opts.secretName != "") {
+		fmt.Fprintln(os.Stderr, "--output secret and --secret-name must be given together")
+		os.Exit(exitUsage)
+	}
+	if *clusterID != "" && (len(clusters) > 1 || *allKubeconfigClusters) {
+		fmt.Fprintln(os.Stderr, "--cluster-id cannot be combined with several clusters")
+		os.Exit(exitUsage)
+	}
+	if opts.tokenDuration <= 0 || opts.tokenDuration > maxTokenDuration {
+		fmt.Fprintf(os.Stderr, "--token-duration must be between 1s and %s\n", maxTokenDuration)
+		os.Exit(exitUsage)
+	}
+	if opts.tokenDuration%time.Second != 0 {
+		fmt.Fprintln(os.Stderr, "--token-duration must be a whole number of seconds")
+		os.Exit(exitUsage)
 	}
 
-	cachePath, err := kubeCacheFilePath(profile, *cluster)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to get cache path: %v\n", err)
-		os.Exit(1)
+	if opts.clockSkew < 0 || opts.clockSkew >= opts.tokenDuration {
+		fmt.Fprintln(os.Stderr, "--clock-skew must be non-negative and less than --token-duration")
+		os.Exit(exitUsage)
+	}
+	if opts.maxClockSkew < 0 {
+		fmt.Fprintln(os.Stderr, "--max-clock-skew must be non-negative")
+		os.Exit(exitUsage)
+	}
+	if opts.cachePadding < 0 || opts.cacheJitter < 0 {
+		fmt.Fprintln(os.Stderr, "--cache-expiry-padding and --cache-expiry-jitter must be non-negative")
+		os.Exit(exitUsage)
 	}
 
-	// Try to use cached token if valid
-	if cred, ok := tryReadValidCache(cachePath); ok {
-		fmt.Println(string(cred))
-		return
+	var targets []tokenTarget
+	if len(clusters) == 0 && *clusterID == "" && !*allKubeconfigClusters {
+		// Without any cluster flags, derive the cluster from the cluster info passed by kubectl, or else
+		// the current kubeconfig context
+		t, ok, err := execInfoTokenTarget(g)
+		if err == nil && !ok {
+			t, err = currentContextTokenTarget(g)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "No --cluster-name given and %v\n", err)
+			getTokenCmd.Usage()
+			os.Exit(exitUsage)
+		}
+		targets = append(targets, t)
+	}
+	for _, cluster := range clusters {
+		t, err := newTokenTarget(g, cluster, *clusterID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		targets = append(targets, t)
+	}
+	if len(clusters) == 0 && *clusterID != "" {
+		t, err := newTokenTarget(g, "", *clusterID)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitUsage)
+		}
+		targets = append(targets, t)
+	}
+	if *allKubeconfigClusters {
+		kubeTargets, err := kubeconfigTokenTargets(g)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to read kubeconfig clusters: %v\n", err)
+			os.Exit(1)
+		}
+		targets = append(targets, kubeTargets...)
 	}
 
-	// Create context for AWS operations
+	// Create context for AWS operations, bounded by --timeout so that stalled
+	// credential resolution (IMDS probes, SSO refresh) cannot hang kubectl
 	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
 
-	// Set up AWS configuration
-	cfg, err := config.LoadDefaultConfig(ctx,
-		config.WithRegion(*region),
-		config.WithSharedConfigProfile(profile),
-	)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to load AWS config: %v\n", err)
-		os.Exit(1)
+	for i := range targets {
+		if targets[i].server == "" {
+			continue
+		}
+		if err := resolveEndpointTarget(ctx, opts, &targets[i]); err != nil {
+			os.Exit(reportGetTokenError(g, err))
+		}
+	}
+	paddingGiven := false
+	getTokenCmd.Visit(func(f *flag.Flag) {
+		paddingGiven = paddingGiven || f.Name == "cache-expiry-padding"
+	})
+	for i := range targets {
+		if *roleARN != "" {
+			targets[i].roleARN = *roleARN
+		}
+		// Per-cluster padding from the configuration file applies unless the flag is given
+		targets[i].cachePadding = opts.cachePadding
+		if p := settings.clusterSettings(targets[i]).CacheExpiryPadding; p != nil && !paddingGiven {
+			targets[i].cachePadding = time.Duration(*p)
+		}
+	}
+	for _, t := range targets {
+		if opts.discoverRegion && t.cluster == "" {
+			fmt.Fprintln(os.Stderr, "--discover-region requires --cluster-name")
+			os.Exit(exitUsage)
+		}
 	}
 
-	// Create STS client and presign client
-	stsSvc := sts.NewFromConfig(cfg)
+	if opts.dryRun {
+		// With several failing clusters, the exit code is that of the last failure
+		failed := 0
+		for i, t := range targets {
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := dryRun(ctx, opts, t); err != nil {
+				failed = reportGetTokenError(g, fmt.Errorf("cluster %s: %w", t.clusterID, err))
+			}
+		}
+		if failed != 0 {
+			os.Exit(failed)
+		}
+		return
+	}
 
-	// Create custom presigner with expiration support
-	presigner := v4.NewSigner()
-	customPresigner := &eksPresigner{
-		signer:  presigner,
-		expires: maxTokenDuration,
+	if opts.touchID {
+		var ids []string
+		for _, t := range targets {
+			ids = append(ids, t.clusterID)
+		}
+		if err := confirmTouchID(fmt.Sprintf("release an EKS token for %s", strings.Join(ids, ", "))); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to confirm with Touch ID: %v\n", err)
+			os.Exit(exitCode(err))
+		}
 	}
 
-	presignClient := sts.NewPresignClient(stsSvc, func(po *sts.PresignOptions) {
-		po.Presigner = customPresigner
-	})
+	// A single cluster yields a plain ExecCredential, several a map of cluster to ExecCredential
+	if len(clusters) <= 1 && !*allKubeconfigClusters {
+		out, summary, err := getToken(ctx, opts, targets[0])
+		if err != nil {
+			os.Exit(reportGetTokenError(g, err))
+		}
+		printOutput(out, opts)
+		if opts.showExpiry {
+			fmt.Fprintln(os.Stderr, summary)
+		}
+		return
+	}
 
-	// Presign the GetCallerIdentity request with custom header
-	presignResult, err := presignClient.PresignGetCallerIdentity(ctx,
-		&sts.GetCallerIdentityInput{},
-		func(po *sts.PresignOptions) {
-			po.ClientOptions = append(po.ClientOptions, func(o *sts.Options) {
-				o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
-					return stack.Build.Add(middleware.BuildMiddlewareFunc(
-						"AddEKSHeader",
-						func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (
-							middleware.BuildOutput, middleware.Metadata, error,
-						) {
-							if req, ok := in.Request.(*smithyhttp.Request); ok {
-								req.Header.Add("x-k8s-aws-id", *cluster)
-							}
-							return next.HandleBuild(ctx, in)
-						},
-					), middleware.Before)
-				})
-			})
-		},
-	)
+	creds := make(map[string]json.RawMessage, len(targets))
+	var summaries []tokenSummary
+	failed := 0
+	for _, t := range targets {
+		out, summary, err := getToken(ctx, opts, t)
+		if err != nil {
+			failed = reportGetTokenError(g, fmt.Errorf("cluster %s: %w", t.clusterID, err))
+			continue
+		}
+		creds[t.clusterID] = out
+		summaries = append(summaries, summary)
+	}
+	out, err := json.MarshalIndent(creds, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to presign STS request: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to marshal ExecCredentials: %v\n", err)
 		os.Exit(1)
 	}
+	// In machine mode, consumers get either all credentials or nothing
+	if failed == 0 || !opts.machine {
+		printOutput(out, opts)
+	}
+	if opts.showExpiry {
+		for _, summary := range summaries {
+			fmt.Fprintln(os.Stderr, summary)
+		}
+	}
+	if failed != 0 {
+		os.Exit(failed)
+	}
+}
 
-	urlStr := presignResult.URL
+// stdout is where the output is written. enforceStdoutPurity detaches it from os.Stdout.
+var stdout = os.Stdout
 
-	token := "k8s-aws-v1." + encodeBase64Url(urlStr)
-	expiry := time.Now().Add(maxTokenDuration).UTC().Format(time.RFC3339)
+// enforceStdoutPurity points os.Stdout at stderr, keeping the real stdout for the output only, so that no
+// warning or prompt, from this tool or a library, can get interleaved with the credential kubectl parses.
+// The output is written with a single write once complete.
+func enforceStdoutPurity() {
+	os.Stdout = os.Stderr
+}
 
-	cred := ExecCredential{
-		APIVersion: "client.authentication.k8s.io/v1beta1",
-		Kind:       "ExecCredential",
+// printOutput prints the JSON output, filtered through the --query JMESPath expression if given, in the
+// --output format, to stdout or the --out-file
+func printOutput(out []byte, opts getTokenOptions) {
+	out, err := formatOutput(out, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to format output: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	if opts.outFile != "" {
+		if err := writeFileAtomic(opts.outFile, out, 0600); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", opts.outFile, err)
+			os.Exit(exitCacheIO)
+		}
+		return
 	}
-	cred.Status.ExpirationTimestamp = expiry
-	cred.Status.Token = token
+	if _, err := stdout.Write(out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+		os.Exit(exitCacheIO)
+	}
+}
 
-	// Marshal to JSON
-	out, err := json.MarshalIndent(cred, "", "  ")
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to marshal ExecCredential: %v\n", err)
-		os.Exit(1)
+// formatOutput converts the JSON output to the --output format, filtered through the --query JMESPath
+// expression if given
+func formatOutput(out []byte, opts getTokenOptions) ([]byte, error) {
+	if opts.query != "" {
+		var err error
+		out, err = applyQuery(out, opts.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply --query: %w", err)
+		}
 	}
+	if opts.output == "token" || opts.output == "env" || opts.output == "kubelet" || opts.output == "secret" {
+		var cred ExecCredential
+		if err := json.Unmarshal(out, &cred); err != nil {
+			return nil, fmt.Errorf("failed to parse ExecCredential: %w", err)
+		}
+		switch opts.output {
+		case "secret":
+			return secretYAML(cred, opts.secretName, opts.namespace)
+		case "kubelet":
+			resp, err := kubeletResponse(cred, opts.kubeletMatch, opts.cachePadding)
+			if err != nil {
+				return nil, err
+			}
+			return append(resp, '\n'), nil
+		case "env":
+			return fmt.Appendf(nil, "export KUBE_TOKEN='%s'\nexport KUBE_TOKEN_EXPIRY='%s'\n",
+				cred.Status.Token, cred.Status.ExpirationTimestamp), nil
+		}
+		return []byte(cred.Status.Token + "\n"), nil
+	}
+	if opts.output == "yaml" {
+		return yaml.JSONToYAML(out)
+	}
+	return append(out, '\n'), nil
+}
 
-	// Write to disk
-	if err := os.WriteFile(cachePath, out, 0600); err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to write ExecCredential to file: %v\n", err)
-		os.Exit(1)
+// applyQuery evaluates a JMESPath expression against JSON data and returns the result as JSON, like the
+// --query option of the AWS CLI
+func applyQuery(data []byte, query string) ([]byte, error) {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	result, err := jmespath.Search(query, doc)
+	if err != nil {
+		return nil, err
 	}
+	return json.MarshalIndent(result, "", "  ")
+}
 
-	fmt.Println(string(out))
+// reportGetTokenError prints a get-token failure, calling out timeouts explicitly, and returns the exit code
+func reportGetTokenError(g globalOptions, err error) int {
+	if errors.Is(err, context.DeadlineExceeded) {
+		if logJSON {
+			logger.Error("Timed out", "timeout", g.timeout, "error", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Timed out after %s: %v\n", g.timeout, err)
+		}
+		return exitTimeout
+	}
+	if logJSON {
+		logger.Error("Failed to get token", "error", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "Failed to get token: %v\n", err)
+	}
+	return exitCode(err)
 }
 
-// tryReadValidCache checks for a cached credential file, and returns its contents if it's still valid (expiry > 30s).
-func tryReadValidCache(path string) ([]byte, bool) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, false
+// newTokenTarget resolves the region and profiles to use for a cluster given by name or ARN
+func newTokenTarget(g globalOptions, cluster, clusterID string) (tokenTarget, error) {
+	t := tokenTarget{
+		cluster:     cluster,
+		region:      g.region,
+		regionGiven: g.region != "",
+		profiles:    g.profiles,
+	}
+
+	// A cluster ARN carries the region and account, and the token is bound to the bare cluster name
+	var clusterAccount string
+	if arn.IsARN(cluster) {
+		parsed, err := parseClusterARN(cluster)
+		if err != nil {
+			return t, fmt.Errorf("invalid --cluster-name: %w", err)
+		}
+		if t.region != "" && t.region != parsed.Region {
+			return t, fmt.Errorf("--region %s conflicts with cluster ARN region %s", t.region, parsed.Region)
+		}
+		t.cluster = parsed.Name
+		t.region = parsed.Region
+		t.regionGiven = true
+		clusterAccount = parsed.Account
+	}
+	if t.region == "" && os.Getenv("AWS_REGION") == "" {
+		// AWS_REGION and the profile's region are resolved by the SDK, but AWS_DEFAULT_REGION is
+		// only honoured by the AWS CLI
+		t.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	// The token is bound to the cluster ID, which defaults to the EKS cluster name
+	t.clusterID = t.cluster
+	if clusterID != "" {
+		t.clusterID = clusterID
+	}
+
+	if len(t.profiles) == 0 {
+		if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+			t.profiles = []string{profile}
+		} else if clusterAccount != "" {
+			// Pick the profiles matching the account of the cluster ARN
+			matches, err := profilesForAccount(context.Background(), clusterAccount)
+			if err != nil {
+				return t, fmt.Errorf("failed to read AWS config file: %w", err)
+			}
+			t.profiles = matches
+		}
 	}
-	var cred ExecCredential
-	if err := json.Unmarshal(data, &cred); err != nil {
-		return nil, false
+	if len(t.profiles) == 0 && len(settings.Profiles) > 0 {
+		t.profiles = settings.Profiles
 	}
-	expiry, err := time.Parse(time.RFC3339, cred.Status.ExpirationTimestamp)
+	if len(t.profiles) == 0 && clusterAccount != "" {
+		return t, fmt.Errorf("no profile in %s matches account %s, set AWS_PROFILE or --profile", sharedConfigFile(), clusterAccount)
+	}
+	if len(t.profiles) == 0 {
+		return t, errors.New("AWS_PROFILE environment variable or --profile is required")
+	}
+	return t, nil
+}
+
+// kubeconfigTokenTargets returns a target for every kubeconfig user with an `eks get-token` exec stanza,
+// using the region and profile from the stanza unless overridden by the global flags.
+func kubeconfigTokenTargets(g globalOptions) ([]tokenTarget, error) {
+	kc, err := loadKubeconfig()
 	if err != nil {
-		return nil, false
+		return nil, err
 	}
-	if time.Until(expiry) > cacheExpiryPadding {
-		return data, true
+	var targets []tokenTarget
+	seen := map[string]bool{}
+	for _, u := range kc.Users {
+		exec, ok := parseGetTokenExec(u.User.Exec)
+		if !ok {
+			continue
+		}
+		t, err := execTokenTarget(g, exec)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", u.Name, err)
+		}
+		if seen[t.clusterID] {
+			continue
+		}
+		seen[t.clusterID] = true
+		targets = append(targets, t)
 	}
-	return nil, false
+	return targets, nil
 }
 
-// encodeBase64Url encodes a string to URL-safe base64 with no padding, per EKS requirements
-func encodeBase64Url(s string) string {
-	return base64.RawURLEncoding.EncodeToString([]byte(s))
+// execTokenTarget returns the target of an `eks get-token` exec stanza, using its region and profile unless
+// overridden by the global flags
+func execTokenTarget(g globalOptions, exec getTokenExec) (tokenTarget, error) {
+	if g.region == "" {
+		g.region = exec.Region
+	}
+	if len(g.profiles) == 0 && exec.Profile != "" {
+		g.profiles = []string{exec.Profile}
+	}
+	t, err := newTokenTarget(g, exec.Cluster, exec.ClusterID)
+	t.roleARN = exec.RoleARN
+	return t, err
 }
 
-// kubeCacheFilePath returns the file path for the cached token, ensuring .kube and .kube/cache exist.
-func kubeCacheFilePath(profile, cluster string) (string, error) {
-	usr, err := user.Current()
+// execInfoTokenTarget derives the cluster from the cluster info kubectl passes in KUBERNETES_EXEC_INFO when
+// the exec stanza sets provideClusterInfo: true. The exec extension of the cluster entry may name the cluster,
+// region and profile explicitly; otherwise the cluster is looked up by its EKS API server endpoint.
+func execInfoTokenTarget(g globalOptions) (tokenTarget, bool, error) {
+	info, err := readExecInfo()
+	if err != nil || info == nil || info.Spec.Cluster == nil {
+		return tokenTarget{}, false, err
+	}
+	cluster := info.Spec.Cluster
+	cfg, err := cluster.clusterConfig()
 	if err != nil {
-		return "", err
+		return tokenTarget{}, false, err
+	}
+	if g.region == "" {
+		g.region = cfg.Region
+	}
+	if len(g.profiles) == 0 && cfg.Profile != "" {
+		g.profiles = []string{cfg.Profile}
+	}
+	if cfg.ClusterName != "" || cfg.ClusterID != "" {
+		t, err := newTokenTarget(g, cfg.ClusterName, cfg.ClusterID)
+		t.roleARN = cfg.RoleARN
+		return t, true, err
 	}
-	kubeDir := filepath.Join(usr.HomeDir, ".kube")
-	cacheDir := filepath.Join(kubeDir, "cache")
 
-	// Ensure .kube/cache directory exists
-	if err := os.MkdirAll(cacheDir, 0700); err != nil {
-		return "", fmt.Errorf("failed to create .kube/cache directory: %w", err)
+	region := eksRegionFromServer(cluster.Server)
+	if region == "" {
+		return tokenTarget{}, false, nil
+	}
+	if g.region == "" {
+		g.region = region
 	}
+	t, err := newTokenTarget(g, "", "")
+	t.server = cluster.Server
+	return t, true, err
+}
 
-	filename := fmt.Sprintf("eks-token-%s-%s.json", profile, cluster)
-	return filepath.Join(cacheDir, filename), nil
+// resolveEndpointTarget fills in the cluster name of a target known only by its API server endpoint
+func resolveEndpointTarget(ctx context.Context, opts getTokenOptions, t *tokenTarget) error {
+	if !opts.noCache {
+		for _, profile := range t.profiles {
+			path, err := discoveryCacheFilePath("endpoints", profile)
+			if err != nil {
+				return err
+			}
+			if name, ok := lookupDiscoveryCache(path, t.server); ok {
+				t.cluster, t.clusterID = name, name
+				return nil
+			}
+		}
+	}
+	cfg, profile, err := loadFirstWorkingConfig(ctx, t.region, t.roleARN, t.profiles)
+	if err != nil {
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	name, err := discoverClusterByEndpoint(ctx, cfg, profile, t.server, !opts.noCache)
+	if err != nil {
+		return fmt.Errorf("failed to find cluster by endpoint: %w", err)
+	}
+	t.cluster, t.clusterID = name, name
+	return nil
 }
 
-// eksPresigner is a custom presigner that adds X-Amz-Expires query parameter for EKS tokens
-type eksPresigner struct {
-	signer  *v4.Signer
-	expires time.Duration
+// currentContextTokenTarget derives the cluster, region and profile from the current kubeconfig context.
+// The exec stanza of the context's user is preferred, falling back to a cluster entry named by its ARN, as
+// written by `aws eks update-kubeconfig`, or a cluster entry with an EKS server URL.
+func currentContextTokenTarget(g globalOptions) (tokenTarget, error) {
+	kc, err := loadKubeconfig()
+	if err != nil {
+		return tokenTarget{}, err
+	}
+	if kc.CurrentContext == "" {
+		return tokenTarget{}, errors.New("the kubeconfig has no current context")
+	}
+	kctx := kc.context(kc.CurrentContext)
+	if kctx == nil {
+		return tokenTarget{}, fmt.Errorf("current context %q not found in kubeconfig", kc.CurrentContext)
+	}
+
+	if u := kc.user(kctx.AuthInfo); u != nil {
+		if exec, ok := parseGetTokenExec(u.Exec); ok {
+			if g.region == "" {
+				g.region = exec.Region
+			}
+			if len(g.profiles) == 0 && exec.Profile != "" {
+				g.profiles = []string{exec.Profile}
+			}
+			t, err := newTokenTarget(g, exec.Cluster, exec.ClusterID)
+			t.roleARN = exec.RoleARN
+			return t, err
+		}
+	}
+	if arn.IsARN(kctx.Cluster) {
+		return newTokenTarget(g, kctx.Cluster, "")
+	}
+	if c := kc.cluster(kctx.Cluster); c != nil {
+		if region := eksRegionFromServer(c.Server); region != "" {
+			if g.region == "" {
+				g.region = region
+			}
+			// eksctl names cluster entries NAME.REGION.eksctl.io, others use the bare cluster name
+			name := strings.TrimSuffix(kctx.Cluster, "."+region+".eksctl.io")
+			return newTokenTarget(g, name, "")
+		}
+	}
+	return tokenTarget{}, fmt.Errorf("cannot derive the EKS cluster from current context %q", kc.CurrentContext)
 }
 
-// PresignHTTP implements the HTTPPresignerV4 interface with custom expiration
-func (p *eksPresigner) PresignHTTP(
-	ctx context.Context,
-	credentials aws.Credentials,
-	r *http.Request,
-	payloadHash string,
-	service string,
-	region string,
-	signingTime time.Time,
-	optFns ...func(*v4.SignerOptions),
-) (string, http.Header, error) {
-	// Add X-Amz-Expires query parameter before signing
-	q := r.URL.Query()
-	q.Set("X-Amz-Expires", fmt.Sprintf("%d", int(p.expires.Seconds())))
-	r.URL.RawQuery = q.Encode()
+// stringSliceFlag is a flag.Value collecting every occurrence of a repeatable flag
+type stringSliceFlag []string
+
+func (s *stringSliceFlag) String() string {
+	return strings.Join(*s, ",")
+}
 
-	return p.signer.PresignHTTP(ctx, credentials, r, payloadHash, service, region, signingTime, optFns...)
+func (s *stringSliceFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
 }
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// checkCachePermissions is a no-op on platforms without Unix file ownership and permissions
+func checkCachePermissions(string, bool, bool) error {
+	return nil
+}
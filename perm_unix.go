@@ -0,0 +1,40 @@
+//go:build unix
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// checkCachePermissions verifies that a cache file, or the cache directory if dir is set, is owned by the
+// current user and not accessible by others. With fix, permissions are tightened instead of failing. A
+// missing file passes.
+func checkCachePermissions(path string, dir, fix bool) error {
+	stat, want, mask := os.Lstat, os.FileMode(0600), os.FileMode(0077)
+	if dir {
+		// The directory may be a symlink, and only write access by others lets them swap tokens
+		stat, want, mask = os.Stat, 0700, 0022
+	}
+	fi, err := stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !dir && !fi.Mode().IsRegular() {
+		return &insecureCacheError{path: path, reason: "not a regular file"}
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		return &insecureCacheError{path: path, reason: fmt.Sprintf("owned by uid %d", st.Uid)}
+	}
+	if fi.Mode().Perm()&mask == 0 {
+		return nil
+	}
+	if fix {
+		return os.Chmod(path, want)
+	}
+	return &insecureCacheError{path: path, reason: fmt.Sprintf("mode %04o", fi.Mode().Perm()), fixable: true}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// remoteCache configures the shared DynamoDB token cache
+type remoteCache struct {
+	// DynamoDBTable is a table with the string partition key "id"
+	DynamoDBTable string `json:"dynamodb-table,omitempty"`
+	// Region of the table, default the region a token is minted in
+	Region string `json:"region,omitempty"`
+}
+
+// remoteCacheTTL is how long after writing DynamoDB may expire a shared token, via the table's TTL attribute
+const remoteCacheTTL = maxTokenDuration + time.Hour
+
+// dynamoTokenStore shares tokens between machines, e.g. short-lived CI runners of a pipeline, through a
+// DynamoDB table. Items are keyed by the caller identity of the token's profile and the cache entry name, so
+// a token is only ever served to the identity it was minted by.
+type dynamoTokenStore struct {
+	table  string
+	region string
+}
+
+// dynamoConfigs caches the AWS config per profile and region for the lifetime of the process
+var dynamoConfigs sync.Map
+
+// dynamoIdentities caches the caller identity ARN per profile for the lifetime of the process
+var dynamoIdentities sync.Map
+
+func newDynamoTokenStore(rc remoteCache) (dynamoTokenStore, error) {
+	if rc.DynamoDBTable == "" {
+		return dynamoTokenStore{}, errors.New("the dynamodb cache backend requires remote-cache.dynamodb-table")
+	}
+	return dynamoTokenStore{table: rc.DynamoDBTable, region: rc.Region}, nil
+}
+
+// client returns a DynamoDB client using the credentials of the profile of the named entry, and the item key
+// of the entry for that profile's caller identity
+func (s dynamoTokenStore) client(ctx context.Context, name string) (*dynamodb.Client, string, error) {
+	e, ok := parseCacheEntry(name)
+	if !ok {
+		return nil, "", fmt.Errorf("invalid cache entry name %s", name)
+	}
+	region := s.region
+	if region == "" {
+		region = e.region
+	}
+	var cfg aws.Config
+	if c, ok := dynamoConfigs.Load(e.profile + "/" + region); ok {
+		cfg = c.(aws.Config)
+	} else {
+		var err error
+		cfg, err = config.LoadDefaultConfig(ctx, config.WithSharedConfigProfile(e.profile), config.WithRegion(region))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load AWS config for DynamoDB: %w", err)
+		}
+		dynamoConfigs.Store(e.profile+"/"+region, cfg)
+	}
+	// Items are never keyed without an identity, as such a key would be shared by every identity
+	identity, ok := dynamoIdentities.Load(e.profile)
+	if !ok {
+		var err error
+		identity, err = dynamoIdentity(ctx, cfg, e.profile)
+		if err != nil {
+			return nil, "", err
+		}
+		dynamoIdentities.Store(e.profile, identity)
+	}
+	return dynamodb.NewFromConfig(cfg), fmt.Sprintf("%s#%s", identity, name), nil
+}
+
+// dynamoIdentity returns the caller identity ARN of the profile. It is remembered in the cache directory
+// for discoveryCacheTTL, keyed by the profile's identity fingerprint, so cache hits don't need an STS call.
+func dynamoIdentity(ctx context.Context, cfg aws.Config, profile string) (string, error) {
+	fingerprint := identityFingerprint(ctx, profile)
+	cachePath, err := discoveryCacheFilePath("identities", profile)
+	if err != nil {
+		return "", err
+	}
+	if identity, ok := lookupDiscoveryCache(cachePath, fingerprint); ok {
+		return identity, nil
+	}
+	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	identity := aws.ToString(out.Arn)
+	if identity == "" {
+		return "", errors.New("failed to get caller identity: no ARN returned")
+	}
+	storeDiscoveryCache(cachePath, fingerprint, identity)
+	return identity, nil
+}
+
+func (s dynamoTokenStore) load(ctx context.Context, name string) ([]byte, error) {
+	client, id, err := s.client(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	out, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.table),
+		Key:            map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read shared token: %w", err)
+	}
+	data, ok := out.Item["data"].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil, fmt.Errorf("no shared token %s", name)
+	}
+	return data.Value, nil
+}
+
+func (s dynamoTokenStore) save(ctx context.Context, name string, data []byte) error {
+	client, id, err := s.client(ctx, name)
+	if err != nil {
+		return err
+	}
+	_, err = client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.table),
+		Item: map[string]types.AttributeValue{
+			"id":      &types.AttributeValueMemberS{Value: id},
+			"data":    &types.AttributeValueMemberB{Value: data},
+			"expires": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(remoteCacheTTL).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write shared token: %w", err)
+	}
+	return nil
+}
+
+func (dynamoTokenStore) list(context.Context) ([]string, error) {
+	return nil, errors.New("listing cached tokens is not supported with the dynamodb cache backend")
+}
+
+func (dynamoTokenStore) remove(context.Context, string) error {
+	return errors.New("removing cached tokens is not supported with the dynamodb cache backend, they expire via the table's TTL")
+}
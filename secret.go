@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"sigs.k8s.io/yaml"
+)
+
+// secretExpiryAnnotation records the token expiry on rendered Secrets
+const secretExpiryAnnotation = "eks-get-token/expiration-timestamp"
+
+// secretManifest is a v1 Secret as rendered by --output secret
+type secretManifest struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"metadata"`
+	Type string            `json:"type"`
+	Data map[string]string `json:"data"`
+}
+
+// secretYAML renders an Opaque Secret holding the token under the key "token", ready for kubectl apply
+func secretYAML(cred ExecCredential, name, namespace string) ([]byte, error) {
+	s := secretManifest{APIVersion: "v1", Kind: "Secret", Type: "Opaque"}
+	s.Metadata.Name = name
+	s.Metadata.Namespace = namespace
+	s.Metadata.Annotations = map[string]string{secretExpiryAnnotation: cred.Status.ExpirationTimestamp}
+	s.Data = map[string]string{"token": base64.StdEncoding.EncodeToString([]byte(cred.Status.Token))}
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.JSONToYAML(data)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultVerifyAddress is the listen address of aws-iam-authenticator's server
+	defaultVerifyAddress = "127.0.0.1:21362"
+	// maxTokenReviewSize bounds the TokenReview requests read by the webhook
+	maxTokenReviewSize = 64 * 1024
+)
+
+// tokenReview is the part of an authentication.k8s.io TokenReview the webhook reads and writes
+type tokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       *tokenReviewSpec  `json:"spec,omitempty"`
+	Status     tokenReviewStatus `json:"status"`
+}
+
+type tokenReviewSpec struct {
+	Token string `json:"token"`
+}
+
+type tokenReviewStatus struct {
+	Authenticated bool             `json:"authenticated"`
+	User          *tokenReviewUser `json:"user,omitempty"`
+	Error         string           `json:"error,omitempty"`
+}
+
+type tokenReviewUser struct {
+	Username string              `json:"username"`
+	UID      string              `json:"uid"`
+	Extra    map[string][]string `json:"extra,omitempty"`
+}
+
+// runServerVerify implements `server verify`
+func runServerVerify(g globalOptions, args []string) {
+	var v tokenVerifier
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	verifyCmd.StringVar(&v.clusterID, "cluster-id", "", "Cluster ID tokens must be bound to (required)")
+	verifyCmd.Var((*stringSliceFlag)(&v.stsHosts), "sts-host", "STS host tokens may be sent to, may be repeated (default any global, regional or FIPS STS endpoint)")
+	listen := verifyCmd.String("listen", defaultVerifyAddress, "Address to serve the webhook on")
+	certFile := verifyCmd.String("tls-cert-file", "", "Serve HTTPS with this certificate, PEM encoded")
+	keyFile := verifyCmd.String("tls-key-file", "", "Private key of --tls-cert-file")
+	verifyCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: server verify --cluster-id ID [--sts-host HOST]... [--listen ADDR] [--tls-cert-file FILE --tls-key-file FILE]")
+		fmt.Fprintln(os.Stderr, "Serves a TokenReview webhook on POST /authenticate and a health check on /healthz.")
+		verifyCmd.PrintDefaults()
+	}
+	if err := verifyCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if verifyCmd.NArg() != 0 || v.clusterID == "" {
+		verifyCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if (*certFile == "") != (*keyFile == "") {
+		fmt.Fprintln(os.Stderr, "--tls-cert-file and --tls-key-file must be given together")
+		os.Exit(exitUsage)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /authenticate", func(w http.ResponseWriter, r *http.Request) {
+		serveTokenReview(w, r, v, g.timeout)
+	})
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	srv := &http.Server{Addr: *listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	fmt.Fprintf(os.Stderr, "Verifying tokens for cluster ID %s on %s\n", v.clusterID, *listen)
+	var err error
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Failed to serve: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// serveTokenReview answers a TokenReview with the identity of its token. Invalid tokens are answered as
+// unauthenticated with the reason; only malformed reviews get an HTTP error. timeout bounds the STS call if
+// positive.
+func serveTokenReview(w http.ResponseWriter, r *http.Request, v tokenVerifier, timeout time.Duration) {
+	var review tokenReview
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxTokenReviewSize)).Decode(&review); err != nil {
+		http.Error(w, fmt.Sprintf("invalid TokenReview: %v", err), http.StatusBadRequest)
+		return
+	}
+	if review.Kind != "TokenReview" || review.Spec == nil {
+		http.Error(w, "invalid TokenReview: expected kind TokenReview with a spec", http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result := v.verify(ctx, review.Spec.Token)
+
+	// The token is not echoed back
+	review.Spec = nil
+	if result.Valid {
+		logger.Info("Authenticated token", "arn", result.ARN, "access-key-id", result.AccessKeyID)
+		review.Status = tokenReviewStatus{Authenticated: true, User: &tokenReviewUser{
+			Username: result.PrincipalARN,
+			// The UID format of aws-iam-authenticator
+			UID: "aws-iam-authenticator:" + result.Account + ":" + result.UserID,
+			Extra: map[string][]string{
+				"arn":          {result.ARN},
+				"canonicalArn": {result.PrincipalARN},
+				"sessionName":  {result.SessionName},
+				"accessKeyId":  {result.AccessKeyID},
+				"principalId":  {result.UserID},
+			},
+		}}
+	} else {
+		logger.Info("Rejected token", "error", result.Error)
+		review.Status = tokenReviewStatus{Error: result.Error}
+	}
+	data, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// statsLockTimeout bounds how long recording statistics may delay serving a token
+const statsLockTimeout = time.Second
+
+// clusterStats counts how tokens for a cluster were served
+type clusterStats struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+	// Mints counts tokens signed, i.e. misses plus refreshes bypassing the cache
+	Mints int64 `json:"mints"`
+}
+
+// cacheStats are the statistics of all clusters since Since
+type cacheStats struct {
+	Since    time.Time               `json:"since"`
+	Clusters map[string]clusterStats `json:"clusters"`
+}
+
+// statsFilePath returns the path of the statistics file in the cache directory
+func statsFilePath() (string, error) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "eks-stats.json"), nil
+}
+
+// readStats reads the statistics, returning empty ones if the file is missing or invalid
+func readStats(path string) cacheStats {
+	stats := cacheStats{Since: time.Now().UTC(), Clusters: map[string]clusterStats{}}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return stats
+	}
+	var s cacheStats
+	if err := json.Unmarshal(data, &s); err != nil || s.Clusters == nil {
+		return stats
+	}
+	return s
+}
+
+// recordStats counts a token served for the cluster, cache being "hit", "miss" or "refresh". Failures are
+// ignored, since statistics must never fail token generation.
+func recordStats(clusterID, cache string) {
+	path, err := statsFilePath()
+	if err != nil {
+		return
+	}
+	unlock := lockCache(context.Background(), path, statsLockTimeout)
+	defer unlock()
+
+	stats := readStats(path)
+	c := stats.Clusters[clusterID]
+	switch cache {
+	case "hit":
+		c.Hits++
+	case "miss":
+		c.Misses++
+		c.Mints++
+	default:
+		c.Mints++
+	}
+	stats.Clusters[clusterID] = c
+	if data, err := json.MarshalIndent(stats, "", "  "); err == nil {
+		_ = writeFileAtomic(path, data, 0600)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name cached tokens are stored under in the OS keyring
+const keyringService = "go-aws-eks-get-token"
+
+// cacheBackendFlag is the --cache-backend global flag, overriding the configuration file
+var cacheBackendFlag string
+
+// tokenStore persists cached ExecCredentials
+type tokenStore interface {
+	// load returns the cached ExecCredential with the given name, or an error if there is none
+	load(ctx context.Context, name string) ([]byte, error)
+	// save stores the ExecCredential under the given name
+	save(ctx context.Context, name string, data []byte) error
+	// list returns the names of all cached tokens, see tokenCacheKey.name
+	list(ctx context.Context) ([]string, error)
+	// remove deletes the cached token with the given name
+	remove(ctx context.Context, name string) error
+}
+
+// newTokenStore returns the token cache backend selected by --cache-backend or the configuration file. File
+// and DynamoDB caches are encrypted if configured.
+func newTokenStore() (tokenStore, error) {
+	switch backend := cacheBackend(); backend {
+	case "file":
+		return newEncryptedStore(fileTokenStore{}, cacheEncryptionSettings())
+	case "keyring":
+		return keyringTokenStore{}, nil
+	case "dynamodb":
+		store, err := newDynamoTokenStore(settings.RemoteCache)
+		if err != nil {
+			return nil, err
+		}
+		return newEncryptedStore(store, cacheEncryptionSettings())
+	case "command":
+		return newCommandTokenStore(settings.CacheGetCommand, settings.CachePutCommand)
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q, must be 'file', 'keyring', 'command' or 'dynamodb'", backend)
+	}
+}
+
+// cacheBackend returns the name of the token cache backend selected by --cache-backend or the configuration
+// file, which defaults to the cache command hooks if configured
+func cacheBackend() string {
+	if cacheBackendFlag != "" {
+		return cacheBackendFlag
+	}
+	if settings.CacheBackend != "" {
+		return settings.CacheBackend
+	}
+	if len(settings.CacheGetCommand) > 0 || len(settings.CachePutCommand) > 0 {
+		return "command"
+	}
+	return "file"
+}
+
+// fileTokenStore keeps tokens as files in the cache directory
+type fileTokenStore struct{}
+
+func (fileTokenStore) load(_ context.Context, name string) ([]byte, error) {
+	path, err := checkedCacheFilePath(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+func (fileTokenStore) save(_ context.Context, name string, data []byte) error {
+	path, err := checkedCacheFilePath(name)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// fixPermissionsFlag is the --fix-permissions global flag
+var fixPermissionsFlag bool
+
+// insecureCacheError reports a cache file or directory others could read or tamper with
+type insecureCacheError struct {
+	path    string
+	reason  string
+	fixable bool
+}
+
+func (e *insecureCacheError) Error() string {
+	if e.fixable {
+		return fmt.Sprintf("insecure permissions on %s (%s), fix them or use --fix-permissions", e.path, e.reason)
+	}
+	return fmt.Sprintf("refusing to use %s: %s", e.path, e.reason)
+}
+
+// checkedCacheFilePath returns the path of the named cache file after verifying the permissions of the file
+// and the cache directory
+func checkedCacheFilePath(name string) (string, error) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err := checkCachePermissions(cacheDir, true, fixPermissionsFlag); err != nil {
+		return "", err
+	}
+	path := filepath.Join(cacheDir, name+".json")
+	if err := checkCachePermissions(path, false, fixPermissionsFlag); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func (fileTokenStore) list(_ context.Context) ([]string, error) {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(cacheDir, "eks-token-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, p := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(p), ".json"))
+	}
+	return names, nil
+}
+
+func (fileTokenStore) remove(_ context.Context, name string) error {
+	cacheDir, err := kubeCacheDir()
+	if err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(cacheDir, name+".json"))
+}
+
+// keyringTokenStore keeps tokens in the OS keyring: the macOS Keychain, the Windows Credential Manager or
+// the Secret Service (e.g. GNOME Keyring) via libsecret's D-Bus API, so that presigned URLs are never
+// written to plain files.
+type keyringTokenStore struct{}
+
+func (keyringTokenStore) load(_ context.Context, name string) ([]byte, error) {
+	s, err := keyring.Get(keyringService, name)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+func (s keyringTokenStore) save(ctx context.Context, name string, data []byte) error {
+	if err := keyring.Set(keyringService, name, string(data)); err != nil {
+		return fmt.Errorf("failed to store token in keyring: %w", err)
+	}
+	names, _ := s.list(ctx)
+	if slices.Contains(names, name) {
+		return nil
+	}
+	return s.saveIndex(append(names, name))
+}
+
+// keyringIndex is the keyring entry listing the names of all cached tokens, since keyrings cannot be
+// enumerated portably
+const keyringIndex = "index"
+
+func (keyringTokenStore) list(_ context.Context) ([]string, error) {
+	s, err := keyring.Get(keyringService, keyringIndex)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal([]byte(s), &names); err != nil {
+		return nil, fmt.Errorf("invalid keyring index: %w", err)
+	}
+	return names, nil
+}
+
+func (s keyringTokenStore) remove(ctx context.Context, name string) error {
+	if err := keyring.Delete(keyringService, name); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	names, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	return s.saveIndex(slices.DeleteFunc(names, func(n string) bool { return n == name }))
+}
+
+func (keyringTokenStore) saveIndex(names []string) error {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(keyringService, keyringIndex, string(data)); err != nil {
+		return fmt.Errorf("failed to update keyring index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// callerIdentity is the identity printed by `sts whoami`
+type callerIdentity struct {
+	Account string `json:"account"`
+	ARN     string `json:"arn"`
+	UserID  string `json:"userId"`
+	// Profile is the profile of the fallback chain whose credentials were used
+	Profile string `json:"profile"`
+}
+
+// runSTSWhoami implements `sts whoami`
+func runSTSWhoami(g globalOptions, args []string) {
+	whoamiCmd := flag.NewFlagSet("whoami", flag.ExitOnError)
+	roleARN := whoamiCmd.String("role-arn", "", "IAM role to assume, as for get-token")
+	output := whoamiCmd.String("output", "text", "Output format, 'text' or 'json'")
+	if err := whoamiCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if whoamiCmd.NArg() != 0 {
+		fmt.Fprintln(os.Stderr, "Usage: sts whoami [--role-arn ARN] [--output text|json]")
+		os.Exit(exitUsage)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'text' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	t, err := newTokenTarget(g, "", "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	// Any region will do for STS, the profile's if it has one
+	cfg, profile, err := loadFirstWorkingConfig(ctx, t.region, *roleARN, t.profiles, config.WithDefaultRegion(discoveryBaseRegion))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to load AWS config: %v\n", err)
+		os.Exit(exitCode(withExitCode(exitCredentials, err)))
+	}
+	out, err := sts.NewFromConfig(cfg).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to get caller identity: %v\n", err)
+		os.Exit(exitCode(err))
+	}
+	identity := callerIdentity{
+		Account: aws.ToString(out.Account),
+		ARN:     aws.ToString(out.Arn),
+		UserID:  aws.ToString(out.UserId),
+		Profile: profile,
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(identity, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal identity: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Account:\t%s\n", identity.Account)
+	fmt.Fprintf(w, "ARN:\t%s\n", identity.ARN)
+	fmt.Fprintf(w, "UserId:\t%s\n", identity.UserID)
+	fmt.Fprintf(w, "Profile:\t%s\n", identity.Profile)
+	w.Flush()
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// ExecCredential is the format for kubectl ExecCredential
+type ExecCredential struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Status     struct {
+		ExpirationTimestamp string `json:"expirationTimestamp"`
+		Token               string `json:"token"`
+	} `json:"status"`
+}
+
+// getToken returns the ExecCredential JSON for the target, served from the cache while still valid.
+func getToken(ctx context.Context, opts getTokenOptions, t tokenTarget) ([]byte, tokenSummary, error) {
+	// The cache entry of the first profile of the chain is used for locking and detecting retries
+	var primaryPath string
+	if !opts.noCache && len(t.profiles) > 0 {
+		if region := cacheRegion(ctx, opts, t, t.profiles[0]); region != "" {
+			key := tokenCacheKey{profile: t.profiles[0], region: region, clusterID: t.clusterID, roleARN: t.roleARN, stsRegion: opts.stsRegion, headers: opts.headers}
+			primaryPath, _ = kubeCacheFilePath(key)
+		}
+	}
+
+	// kubectl invokes the plugin again right away when the API server rejects the token, e.g. because access
+	// entries changed. Serving the same cached token again would loop until it expires, so mint a fresh one.
+	if primaryPath != "" {
+		if isRepeatInvocation(primaryPath) {
+			logger.Info("Repeated invocation by the same process, minting a fresh token", "cluster", t.clusterID)
+			opts.forceRefresh = true
+		}
+		defer recordServe(primaryPath)
+	}
+
+	// Try to use cached token if valid, for any profile in the fallback chain
+	padding := cachePadding(t.cachePadding, opts.cacheJitter)
+	if !opts.noCache && !opts.forceRefresh {
+		env, ok, err := readCachedToken(ctx, opts, t, padding)
+		if err != nil {
+			return nil, tokenSummary{}, err
+		}
+		if ok {
+			return serveToken(opts, t, env, "hit")
+		}
+	}
+
+	// Serialize minting between concurrent processes, e.g. kubectl fanning out, so that one process mints
+	// the token while the others wait and then reuse it from the cache
+	if primaryPath != "" {
+		unlock := lockCache(ctx, primaryPath, cacheLockTimeout)
+		defer unlock()
+		if !opts.forceRefresh {
+			env, ok, err := readCachedToken(ctx, opts, t, padding)
+			if err != nil {
+				return nil, tokenSummary{}, err
+			}
+			if ok {
+				return serveToken(opts, t, env, "hit")
+			}
+		}
+	}
+
+	if !opts.noCache && !opts.forceRefresh {
+		logger.Info("No valid cached token", "cluster", t.clusterID)
+	}
+	cfg, profile, err := loadTargetConfig(ctx, opts, t)
+	if err != nil {
+		return nil, tokenSummary{}, err
+	}
+
+	presignedURL, expiry, err := mintToken(ctx, cfg, opts, t.clusterID)
+	if err != nil {
+		return nil, tokenSummary{}, err
+	}
+	token := "k8s-aws-v1." + encodeBase64Url(presignedURL)
+
+	cred := ExecCredential{
+		APIVersion: opts.execAPIVersion,
+		Kind:       "ExecCredential",
+	}
+	cred.Status.ExpirationTimestamp = expiry.UTC().Format(time.RFC3339)
+	cred.Status.Token = token
+	logger.Info("Minted token", "cluster", t.clusterID, "profile", profile, "region", cfg.Region, "expiry", cred.Status.ExpirationTimestamp)
+
+	env := cacheEnvelope{
+		Version:             cacheFormatVersion,
+		ToolVersion:         toolVersion(),
+		Profile:             profile,
+		Region:              cfg.Region,
+		ClusterID:           t.clusterID,
+		Credential:          cred,
+		IdentityFingerprint: identityFingerprint(ctx, profile),
+	}
+	if auditEnabled() || opts.showExpiry {
+		// The identity is informational only, so failing to get it must not fail or stall token generation
+		lookupCtx, cancel := context.WithTimeout(ctx, identityLookupTimeout)
+		identity, err := newSTSClient(cfg, opts).GetCallerIdentity(lookupCtx, &sts.GetCallerIdentityInput{})
+		cancel()
+		if err == nil {
+			env.IdentityARN = aws.ToString(identity.Arn)
+			warnClockSkew(identity.ResultMetadata, opts.maxClockSkew)
+		}
+	}
+	if opts.noCache {
+		return serveToken(opts, t, env, "disabled")
+	}
+
+	store, err := newTokenStore()
+	if err != nil {
+		return nil, tokenSummary{}, err
+	}
+	key := tokenCacheKey{profile: profile, region: cfg.Region, clusterID: t.clusterID, roleARN: t.roleARN, stsRegion: opts.stsRegion, headers: opts.headers}
+	if err := saveCacheEntry(ctx, store, key.name(), env); err != nil {
+		return nil, tokenSummary{}, withExitCode(exitCacheIO, fmt.Errorf("failed to write ExecCredential to cache: %w", err))
+	}
+	autoGCTokenCache(ctx, store)
+	if opts.forceRefresh {
+		return serveToken(opts, t, env, "refresh")
+	}
+	return serveToken(opts, t, env, "miss")
+}
+
+// identityLookupTimeout bounds the caller identity lookup for the audit log and --show-expiry
+const identityLookupTimeout = 5 * time.Second
+
+// tokenSummary describes an issued token for --show-expiry
+type tokenSummary struct {
+	cluster     string
+	identityARN string
+	expiry      string
+	cache       string
+}
+
+// String returns a one-line human readable summary of the token
+func (s tokenSummary) String() string {
+	msg := "token for cluster " + s.cluster
+	if s.identityARN != "" {
+		msg += " (" + s.identityARN + ")"
+	}
+	if expiry, err := time.Parse(time.RFC3339, s.expiry); err == nil {
+		msg += " valid for " + time.Until(expiry).Round(time.Second).String()
+	}
+	return msg + " (cache " + s.cache + ")"
+}
+
+// serveToken records the issuance of a token in the audit log and statistics and returns its ExecCredential
+// JSON. cache is "hit", "miss", "refresh" (the cache was bypassed) or "disabled".
+func serveToken(opts getTokenOptions, t tokenTarget, env cacheEnvelope, cache string) ([]byte, tokenSummary, error) {
+	summary := tokenSummary{
+		cluster:     t.clusterID,
+		identityARN: env.IdentityARN,
+		expiry:      env.Credential.Status.ExpirationTimestamp,
+		cache:       cache,
+	}
+	if err := writeAuditRecord(t, env, cache); err != nil {
+		return nil, summary, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if cache != "disabled" {
+		recordStats(t.clusterID, cache)
+	}
+	// Cached tokens may have been minted for kubectl speaking another API version
+	env.Credential.APIVersion = opts.execAPIVersion
+	out, err := json.MarshalIndent(env.Credential, "", "  ")
+	if err != nil {
+		return nil, summary, fmt.Errorf("failed to marshal ExecCredential: %w", err)
+	}
+	return out, summary, nil
+}
+
+// readCachedToken returns a cached token that is still valid, trying each profile of the fallback chain
+func readCachedToken(ctx context.Context, opts getTokenOptions, t tokenTarget, padding time.Duration) (cacheEnvelope, bool, error) {
+	store, err := newTokenStore()
+	if err != nil {
+		return cacheEnvelope{}, false, err
+	}
+	for _, profile := range t.profiles {
+		region := cacheRegion(ctx, opts, t, profile)
+		if region == "" {
+			continue
+		}
+		key := tokenCacheKey{profile: profile, region: region, clusterID: t.clusterID, roleARN: t.roleARN, stsRegion: opts.stsRegion, headers: opts.headers}
+		if cacheBackend() == "file" {
+			if cachePath, err := kubeCacheFilePath(key); err == nil {
+				migrateLegacyCache(key, cachePath)
+			}
+		}
+		data, err := store.load(ctx, key.name())
+		var insecure *insecureCacheError
+		if errors.As(err, &insecure) {
+			return cacheEnvelope{}, false, err
+		}
+		if err != nil {
+			logger.Debug("No cached token", "entry", key.name(), "error", err)
+			continue
+		}
+		env, err := decodeCacheEntry(data)
+		if err != nil {
+			logger.Debug("Ignoring unreadable cached token", "entry", key.name(), "error", err)
+			continue
+		}
+		if !validCachedToken(env.Credential, padding, opts.tokenDuration) {
+			logger.Debug("Ignoring cached token expiring too soon", "entry", key.name(), "expiry", env.Credential.Status.ExpirationTimestamp, "padding", padding)
+			continue
+		}
+		// A token minted before the profile switched to another access key or role is stale
+		if env.IdentityFingerprint != "" && env.IdentityFingerprint != identityFingerprint(ctx, profile) {
+			logger.Debug("Ignoring cached token of a changed identity", "entry", key.name())
+			continue
+		}
+		if env.Version < cacheFormatVersion {
+			// Migrate entries of older formats, which lack everything but the credential
+			env = cacheEnvelope{
+				Version:     cacheFormatVersion,
+				ToolVersion: toolVersion(),
+				Profile:     profile,
+				Region:      region,
+				ClusterID:   t.clusterID,
+				Credential:  env.Credential,
+			}
+			if err := saveCacheEntry(ctx, store, key.name(), env); err != nil {
+				logger.Warn("Failed to migrate cached token", "entry", key.name(), "error", err)
+			}
+		}
+		logger.Info("Serving cached token", "cluster", t.clusterID, "profile", profile, "region", region, "expiry", env.Credential.Status.ExpirationTimestamp)
+		return env, true, nil
+	}
+	return cacheEnvelope{}, false, nil
+}
+
+// saveCacheEntry stores a cache envelope under the given name
+func saveCacheEntry(ctx context.Context, store tokenStore, name string, env cacheEnvelope) error {
+	data, err := json.MarshalIndent(env, "", "  ")
+	if err != nil {
+		return err
+	}
+	return store.save(ctx, name, data)
+}
+
+// cacheRegion returns the region a token for the target would be minted in with the given profile, determined
+// without resolving credentials so that the cache can be consulted first. It mirrors the region resolution of
+// loadTargetConfig and returns "" if the region is not known yet.
+func cacheRegion(ctx context.Context, opts getTokenOptions, t tokenTarget, profile string) string {
+	if opts.discoverRegion && !t.regionGiven {
+		path, err := discoveryCacheFilePath("regions", profile)
+		if err != nil {
+			return ""
+		}
+		region, _ := lookupDiscoveryCache(path, t.cluster)
+		return region
+	}
+	if t.region != "" {
+		return t.region
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		return region
+	}
+	region := profileRegion(ctx, profile)
+	logger.Debug("Using region of profile", "profile", profile, "region", region)
+	return region
+}
+
+// loadTargetConfig sets up the AWS configuration for the target using the first profile with working
+// credentials, discovering the cluster region if requested. It returns the config and the profile used.
+func loadTargetConfig(ctx context.Context, opts getTokenOptions, t tokenTarget) (aws.Config, string, error) {
+	if !opts.discoverRegion || t.regionGiven {
+		cfg, profile, err := loadFirstWorkingConfig(ctx, t.region, t.roleARN, t.profiles)
+		if err != nil {
+			return aws.Config{}, "", withExitCode(exitCredentials, fmt.Errorf("failed to load AWS config: %w", err))
+		}
+		return cfg, profile, nil
+	}
+
+	cfg, profile, err := loadFirstWorkingConfig(ctx, "", t.roleARN, t.profiles, config.WithDefaultRegion(discoveryBaseRegion))
+	if err != nil {
+		return aws.Config{}, "", withExitCode(exitCredentials, fmt.Errorf("failed to load AWS config: %w", err))
+	}
+	cfg.Region, err = discoverClusterRegion(ctx, cfg, profile, t.cluster, !opts.noCache)
+	if err != nil {
+		return aws.Config{}, "", fmt.Errorf("failed to discover cluster region: %w", err)
+	}
+	return cfg, profile, nil
+}
+
+// newSTSClient creates an STS client, optionally against a dedicated STS region
+func newSTSClient(cfg aws.Config, opts getTokenOptions) *sts.Client {
+	return sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if opts.stsRegion != "" {
+			o.Region = opts.stsRegion
+		}
+	})
+}
+
+// mintToken presigns an STS GetCallerIdentity request bound to the cluster ID and returns the presigned URL
+// the token is made from, together with the token expiry.
+func mintToken(ctx context.Context, cfg aws.Config, opts getTokenOptions, clusterID string) (string, time.Time, error) {
+	// Create STS client and presign client
+	stsSvc := newSTSClient(cfg, opts)
+
+	// Create custom presigner with expiration support
+	presigner := v4.NewSigner()
+	customPresigner := &eksPresigner{
+		signer:  presigner,
+		expires: opts.tokenDuration,
+		skew:    opts.clockSkew,
+	}
+
+	presignClient := sts.NewPresignClient(stsSvc, func(po *sts.PresignOptions) {
+		po.Presigner = customPresigner
+	})
+
+	// Presign the GetCallerIdentity request with custom header
+	presignResult, err := presignClient.PresignGetCallerIdentity(ctx,
+		&sts.GetCallerIdentityInput{},
+		func(po *sts.PresignOptions) {
+			po.ClientOptions = append(po.ClientOptions, func(o *sts.Options) {
+				o.APIOptions = append(o.APIOptions, func(stack *middleware.Stack) error {
+					return stack.Build.Add(middleware.BuildMiddlewareFunc(
+						"AddEKSHeader",
+						func(ctx context.Context, in middleware.BuildInput, next middleware.BuildHandler) (
+							middleware.BuildOutput, middleware.Metadata, error,
+						) {
+							if req, ok := in.Request.(*smithyhttp.Request); ok {
+								req.Header.Add("x-k8s-aws-id", clusterID)
+								for _, h := range opts.headers {
+									req.Header.Add(h.name, h.value)
+								}
+							}
+							return next.HandleBuild(ctx, in)
+						},
+					), middleware.Before)
+				})
+			})
+		},
+	)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to presign STS request: %w", err)
+	}
+
+	urlStr := presignResult.URL
+
+	// Derive the expiry from what was actually signed rather than the current time, so it matches
+	// what STS enforces
+	expiry, err := presignedURLExpiry(urlStr)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to determine token expiry: %w", err)
+	}
+
+	// A token cannot outlive the credentials it was signed with, so clamp the reported expiry to the
+	// expiration of short-lived credentials (assumed roles, SSO sessions). The credentials are cached
+	// by the config so retrieving them again does not hit the credential source.
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", time.Time{}, withExitCode(exitCredentials, fmt.Errorf("failed to retrieve AWS credentials: %w", err))
+	}
+	return urlStr, clampExpiry(expiry, creds), nil
+}
+
+// dryRun resolves credentials and signs the request like getToken, but prints the caller identity, STS
+// endpoint, signed headers and expiry instead of a usable token, and leaves the cache untouched.
+func dryRun(ctx context.Context, opts getTokenOptions, t tokenTarget) error {
+	cfg, profile, err := loadTargetConfig(ctx, opts, t)
+	if err != nil {
+		return err
+	}
+	identity, err := newSTSClient(cfg, opts).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+	presignedURL, expiry, err := mintToken(ctx, cfg, opts, t.clusterID)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(presignedURL)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Profile:\t%s\n", profile)
+	fmt.Fprintf(w, "Region:\t%s\n", cfg.Region)
+	fmt.Fprintf(w, "Caller identity:\t%s\n", aws.ToString(identity.Arn))
+	fmt.Fprintf(w, "STS endpoint:\t%s://%s\n", u.Scheme, u.Host)
+	fmt.Fprintf(w, "x-k8s-aws-id:\t%s\n", t.clusterID)
+	for _, h := range opts.headers {
+		fmt.Fprintf(w, "%s:\t%s\n", h.name, h.value)
+	}
+	fmt.Fprintf(w, "Signed headers:\t%s\n", u.Query().Get("X-Amz-SignedHeaders"))
+	fmt.Fprintf(w, "Expiry:\t%s (in %s)\n", expiry.UTC().Format(time.RFC3339), time.Until(expiry).Round(time.Second))
+	if skew, ok := clockSkew(identity.ResultMetadata); ok {
+		fmt.Fprintf(w, "Clock skew:\t%s\n", skew)
+	}
+	return w.Flush()
+}
+
+// signedHeader is an additional header signed into the presigned request
+type signedHeader struct {
+	name  string
+	value string
+}
+
+// parseSignedHeader parses a --header key=value flag
+func parseSignedHeader(s string) (signedHeader, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return signedHeader{}, fmt.Errorf("invalid header %q, expected key=value", s)
+	}
+	switch strings.ToLower(name) {
+	case "host", "x-k8s-aws-id":
+		return signedHeader{}, fmt.Errorf("header %q cannot be overridden", name)
+	}
+	return signedHeader{name: name, value: value}, nil
+}
+
+// presignedURLExpiry computes the expiry of a presigned URL from its X-Amz-Date and X-Amz-Expires
+// query parameters, minus tokenExpiryPadding (capped at half the validity for very short tokens).
+func presignedURLExpiry(rawURL string) (time.Time, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+	q := u.Query()
+	signedAt, err := time.Parse("20060102T150405Z", q.Get("X-Amz-Date"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid X-Amz-Date: %w", err)
+	}
+	seconds, err := strconv.Atoi(q.Get("X-Amz-Expires"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid X-Amz-Expires: %w", err)
+	}
+	expires := time.Duration(seconds) * time.Second
+	return signedAt.Add(expires - min(tokenExpiryPadding, expires/2)), nil
+}
+
+// clampExpiry returns the earlier of expiry and the expiration of the credentials, if they can expire.
+func clampExpiry(expiry time.Time, creds aws.Credentials) time.Time {
+	if creds.CanExpire && !creds.Expires.IsZero() && creds.Expires.Before(expiry) {
+		return creds.Expires
+	}
+	return expiry
+}
+
+// encodeBase64Url encodes a string to URL-safe base64 with no padding, per EKS requirements
+func encodeBase64Url(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+// eksPresigner is a custom presigner that adds X-Amz-Expires query parameter for EKS tokens
+type eksPresigner struct {
+	signer  *v4.Signer
+	expires time.Duration
+	// skew backdates the signing time so a fast local clock does not yield tokens that are not yet valid
+	skew time.Duration
+}
+
+// PresignHTTP implements the HTTPPresignerV4 interface with custom expiration
+func (p *eksPresigner) PresignHTTP(
+	ctx context.Context,
+	credentials aws.Credentials,
+	r *http.Request,
+	payloadHash string,
+	service string,
+	region string,
+	signingTime time.Time,
+	optFns ...func(*v4.SignerOptions),
+) (string, http.Header, error) {
+	// Add X-Amz-Expires query parameter before signing
+	q := r.URL.Query()
+	q.Set("X-Amz-Expires", fmt.Sprintf("%d", int(p.expires.Seconds())))
+	r.URL.RawQuery = q.Encode()
+
+	return p.signer.PresignHTTP(ctx, credentials, r, payloadHash, service, region, signingTime.Add(-p.skew), optFns...)
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// redacted replaces secrets in decoded tokens
+const redacted = "<redacted>"
+
+// maxTokenLength is the longest token the EKS authenticator accepts
+const maxTokenLength = 4 * 1024
+
+// stsHostRegex matches the global, regional and FIPS STS endpoints
+var stsHostRegex = regexp.MustCompile(`^sts(-fips)?(\.[a-z0-9-]+)?\.amazonaws\.com(\.cn)?$`)
+
+// tokenQueryParams are the query parameters, lowercased, the EKS authenticator allows in a token
+var tokenQueryParams = map[string]bool{
+	"action":               true,
+	"version":              true,
+	"x-amz-algorithm":      true,
+	"x-amz-credential":     true,
+	"x-amz-date":           true,
+	"x-amz-expires":        true,
+	"x-amz-security-token": true,
+	"x-amz-signature":      true,
+	"x-amz-signedheaders":  true,
+}
+
+// decodedToken is an EKS token as printed by `token decode`
+type decodedToken struct {
+	Host            string    `json:"host"`
+	Region          string    `json:"region"`
+	Action          string    `json:"action"`
+	SignedAt        time.Time `json:"signedAt"`
+	ExpiresSeconds  int       `json:"expiresSeconds"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+	Expired         bool      `json:"expired"`
+	CredentialScope string    `json:"credentialScope"`
+	AccessKeyID     string    `json:"accessKeyId"`
+	SignedHeaders   []string  `json:"signedHeaders"`
+	// ClusterID is the x-k8s-aws-id value, only present if the signer put it in the query
+	ClusterID     string `json:"clusterId,omitempty"`
+	SecurityToken string `json:"securityToken,omitempty"`
+	Signature     string `json:"signature"`
+}
+
+// runTokenDecode implements `token decode`
+func runTokenDecode(args []string) {
+	decodeCmd := flag.NewFlagSet("decode", flag.ExitOnError)
+	showSecrets := decodeCmd.Bool("show-secrets", false, "Print the signature and session token instead of redacting them")
+	output := decodeCmd.String("output", "text", "Output format, 'text' or 'json'")
+	decodeCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: token decode [--show-secrets] [--output text|json] [TOKEN|-]")
+		fmt.Fprintln(os.Stderr, "Reads the token, or an ExecCredential holding it, from stdin if not given.")
+		decodeCmd.PrintDefaults()
+	}
+	if err := decodeCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if decodeCmd.NArg() > 1 {
+		decodeCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'text' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	token, err := readTokenArg(decodeCmd.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read token: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	u, err := tokenURL(token)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decode token: %v\n", err)
+		os.Exit(1)
+	}
+	decoded, err := decodeTokenURL(u)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decode token: %v\n", err)
+		os.Exit(1)
+	}
+	if !*showSecrets {
+		decoded.Signature = redacted
+		if decoded.SecurityToken != "" {
+			decoded.SecurityToken = redacted
+		}
+	}
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(decoded, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal token: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	validity := "expired"
+	if !decoded.Expired {
+		validity = time.Until(decoded.ExpiresAt).Round(time.Second).String() + " left"
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Host:\t%s\n", decoded.Host)
+	fmt.Fprintf(w, "Region:\t%s\n", decoded.Region)
+	fmt.Fprintf(w, "Action:\t%s\n", decoded.Action)
+	fmt.Fprintf(w, "X-Amz-Date:\t%s\n", decoded.SignedAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "X-Amz-Expires:\t%ds\n", decoded.ExpiresSeconds)
+	fmt.Fprintf(w, "Expires:\t%s (%s)\n", decoded.ExpiresAt.Format(time.RFC3339), validity)
+	fmt.Fprintf(w, "Credential scope:\t%s\n", decoded.CredentialScope)
+	fmt.Fprintf(w, "Signed headers:\t%s\n", strings.Join(decoded.SignedHeaders, ";"))
+	fmt.Fprintf(w, "x-k8s-aws-id:\t%s\n", orDash(decoded.ClusterID, "not in the token, sent as signed header by the verifier"))
+	if decoded.SecurityToken != "" {
+		fmt.Fprintf(w, "Security token:\t%s\n", decoded.SecurityToken)
+	}
+	fmt.Fprintf(w, "Signature:\t%s\n", decoded.Signature)
+	w.Flush()
+}
+
+// readTokenArg returns the token given as argument, or read from stdin if it is empty or "-". An
+// ExecCredential as printed by get-token is accepted as well.
+func readTokenArg(arg string) (string, error) {
+	token := arg
+	if arg == "" || arg == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if strings.HasPrefix(token, "{") {
+		var cred ExecCredential
+		if err := json.Unmarshal([]byte(token), &cred); err != nil {
+			return "", fmt.Errorf("failed to parse ExecCredential: %w", err)
+		}
+		token = cred.Status.Token
+	}
+	if token == "" {
+		return "", errors.New("no token given")
+	}
+	return token, nil
+}
+
+// decodeTokenURL extracts the signing parameters of the presigned URL of a token
+func decodeTokenURL(u *url.URL) (decodedToken, error) {
+	q := u.Query()
+	d := decodedToken{
+		Host:            u.Host,
+		Region:          credentialScope(u).region,
+		Action:          q.Get("Action"),
+		CredentialScope: q.Get("X-Amz-Credential"),
+		AccessKeyID:     credentialScope(u).accessKeyID,
+		SignedHeaders:   strings.Split(q.Get("X-Amz-SignedHeaders"), ";"),
+		ClusterID:       q.Get("x-k8s-aws-id"),
+		SecurityToken:   q.Get("X-Amz-Security-Token"),
+		Signature:       q.Get("X-Amz-Signature"),
+	}
+	var err error
+	if d.SignedAt, err = time.Parse("20060102T150405Z", q.Get("X-Amz-Date")); err != nil {
+		return d, fmt.Errorf("invalid X-Amz-Date: %w", err)
+	}
+	if d.ExpiresSeconds, err = strconv.Atoi(q.Get("X-Amz-Expires")); err != nil {
+		return d, fmt.Errorf("invalid X-Amz-Expires: %w", err)
+	}
+	d.ExpiresAt = d.SignedAt.Add(time.Duration(d.ExpiresSeconds) * time.Second)
+	d.Expired = !time.Now().Before(d.ExpiresAt)
+	return d, nil
+}
+
+// verifiedToken is the result of `token verify`
+type verifiedToken struct {
+	Valid     bool      `json:"valid"`
+	Error     string    `json:"error,omitempty"`
+	ClusterID string    `json:"clusterId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	ARN       string    `json:"arn,omitempty"`
+	Account   string    `json:"account,omitempty"`
+	UserID    string    `json:"userId,omitempty"`
+	// PrincipalARN is the IAM principal the cluster maps, the role for assumed roles
+	PrincipalARN string `json:"principalArn,omitempty"`
+	SessionName  string `json:"sessionName,omitempty"`
+	AccessKeyID  string `json:"accessKeyId,omitempty"`
+}
+
+// runTokenVerify implements `token verify`
+func runTokenVerify(g globalOptions, args []string) {
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	clusterID := verifyCmd.String("cluster-id", "", "Cluster ID the token must be bound to, i.e. the EKS cluster name (required)")
+	output := verifyCmd.String("output", "text", "Output format, 'text' or 'json'")
+	verifyCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: token verify --cluster-id ID [--output text|json] [TOKEN|-]")
+		fmt.Fprintln(os.Stderr, "Sends the presigned request of the token to STS, like the EKS authenticator does.")
+		verifyCmd.PrintDefaults()
+	}
+	if err := verifyCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if verifyCmd.NArg() > 1 || *clusterID == "" {
+		verifyCmd.Usage()
+		os.Exit(exitUsage)
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Invalid --output %q, must be 'text' or 'json'\n", *output)
+		os.Exit(exitUsage)
+	}
+
+	token, err := readTokenArg(verifyCmd.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read token: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	result := tokenVerifier{clusterID: *clusterID}.verify(ctx, token)
+
+	if *output == "json" {
+		data, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to marshal result: %v\n", err)
+			os.Exit(1)
+		}
+		if _, err := stdout.Write(append(data, '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	} else if result.Valid {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "ARN:\t%s\n", result.ARN)
+		fmt.Fprintf(w, "Principal:\t%s\n", result.PrincipalARN)
+		fmt.Fprintf(w, "Account:\t%s\n", result.Account)
+		fmt.Fprintf(w, "UserId:\t%s\n", result.UserID)
+		fmt.Fprintf(w, "Cluster ID:\t%s\n", result.ClusterID)
+		fmt.Fprintf(w, "Expires:\t%s (%s left)\n", result.ExpiresAt.Format(time.RFC3339), time.Until(result.ExpiresAt).Round(time.Second))
+		w.Flush()
+	}
+	if !result.Valid {
+		fmt.Fprintf(os.Stderr, "Token is invalid: %s\n", result.Error)
+		os.Exit(1)
+	}
+}
+
+// tokenVerifier checks tokens like the EKS authenticator: it rejects tokens it would not send to STS, then
+// sends their presigned request with the x-k8s-aws-id header of the cluster
+type tokenVerifier struct {
+	clusterID string
+	// stsHosts are the allowed STS hosts, any global or regional STS endpoint if empty
+	stsHosts []string
+}
+
+// verify checks a token and resolves the identity it was signed by. The result is invalid, with the
+// reason as Error, if any check fails.
+func (v tokenVerifier) verify(ctx context.Context, token string) verifiedToken {
+	result := verifiedToken{ClusterID: v.clusterID}
+	if len(token) > maxTokenLength {
+		result.Error = fmt.Sprintf("token longer than %d bytes", maxTokenLength)
+		return result
+	}
+	u, err := tokenURL(token)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	decoded, err := v.checkTokenURL(u)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.ExpiresAt, result.AccessKeyID = decoded.ExpiresAt, decoded.AccessKeyID
+	identity, err := sendTokenRequest(ctx, u, v.clusterID)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Valid = true
+	result.ARN, result.Account, result.UserID = identity.ARN, identity.Account, identity.UserID
+	result.PrincipalARN, result.SessionName = principalARN(identity.ARN)
+	return result
+}
+
+// checkTokenURL decodes the presigned URL of a token and checks it is an unexpired GetCallerIdentity
+// request to an allowed STS host, signing x-k8s-aws-id and carrying only the usual query parameters
+func (v tokenVerifier) checkTokenURL(u *url.URL) (decodedToken, error) {
+	// Never hand a token to anything but STS
+	if u.Scheme != "https" {
+		return decodedToken{}, fmt.Errorf("unexpected scheme %q", u.Scheme)
+	}
+	if !v.allowedHost(u.Host) {
+		return decodedToken{}, fmt.Errorf("host %s is not an allowed STS endpoint", u.Host)
+	}
+	if u.Path != "/" {
+		return decodedToken{}, fmt.Errorf("unexpected path %q", u.Path)
+	}
+	for key, values := range u.Query() {
+		if !tokenQueryParams[strings.ToLower(key)] {
+			return decodedToken{}, fmt.Errorf("query parameter %q is not allowed", key)
+		}
+		if len(values) != 1 {
+			return decodedToken{}, fmt.Errorf("query parameter %q given %d times", key, len(values))
+		}
+	}
+	decoded, err := decodeTokenURL(u)
+	if err != nil {
+		return decoded, err
+	}
+	if decoded.Action != "GetCallerIdentity" {
+		return decoded, fmt.Errorf("unexpected action %q", decoded.Action)
+	}
+	if !slices.Contains(decoded.SignedHeaders, "x-k8s-aws-id") {
+		return decoded, errors.New("x-k8s-aws-id is not a signed header")
+	}
+	if decoded.ExpiresSeconds <= 0 || time.Duration(decoded.ExpiresSeconds)*time.Second > maxTokenDuration {
+		return decoded, fmt.Errorf("X-Amz-Expires %d outside 1-%d seconds", decoded.ExpiresSeconds, int(maxTokenDuration.Seconds()))
+	}
+	if decoded.Expired {
+		return decoded, fmt.Errorf("expired at %s", decoded.ExpiresAt.Format(time.RFC3339))
+	}
+	return decoded, nil
+}
+
+// allowedHost returns whether a token may be sent to host
+func (v tokenVerifier) allowedHost(host string) bool {
+	if len(v.stsHosts) == 0 {
+		return stsHostRegex.MatchString(host)
+	}
+	return slices.Contains(v.stsHosts, host)
+}
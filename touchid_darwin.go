@@ -0,0 +1,51 @@
+//go:build darwin && cgo
+
+package main
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework LocalAuthentication
+#include <stdlib.h>
+#import <Foundation/Foundation.h>
+#import <LocalAuthentication/LocalAuthentication.h>
+
+// authenticate blocks until the user confirms with Touch ID. It returns 1 on success, 0 if authentication
+// failed or was cancelled, and -1 if biometrics are not available.
+static int authenticate(const char *reason) {
+	LAContext *ctx = [[LAContext alloc] init];
+	NSError *err = nil;
+	if (![ctx canEvaluatePolicy:LAPolicyDeviceOwnerAuthenticationWithBiometrics error:&err]) {
+		return -1;
+	}
+	dispatch_semaphore_t sema = dispatch_semaphore_create(0);
+	__block int result = 0;
+	[ctx evaluatePolicy:LAPolicyDeviceOwnerAuthenticationWithBiometrics
+	    localizedReason:[NSString stringWithUTF8String:reason]
+	              reply:^(BOOL success, NSError *error) {
+		result = success ? 1 : 0;
+		dispatch_semaphore_signal(sema);
+	}];
+	dispatch_semaphore_wait(sema, DISPATCH_TIME_FOREVER);
+	return result;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// confirmTouchID asks the user to confirm with Touch ID, showing reason in the system prompt
+func confirmTouchID(reason string) error {
+	cReason := C.CString(reason)
+	defer C.free(unsafe.Pointer(cReason))
+	switch C.authenticate(cReason) {
+	case 1:
+		return nil
+	case -1:
+		return withExitCode(exitUsage, errors.New("biometric authentication is not available on this Mac"))
+	default:
+		return withExitCode(exitCredentials, errors.New("authentication failed or was cancelled"))
+	}
+}
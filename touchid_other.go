@@ -0,0 +1,10 @@
+//go:build !darwin || !cgo
+
+package main
+
+import "errors"
+
+// confirmTouchID is only available in macOS builds with cgo, as it calls the LocalAuthentication framework
+func confirmTouchID(string) error {
+	return withExitCode(exitUsage, errors.New("biometric confirmation requires a macOS build with cgo enabled"))
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+)
+
+// kubeconfigUpdate is a cluster to add to the kubeconfig, or the failure to list or describe clusters
+type kubeconfigUpdate struct {
+	// name is the cluster ARN
+	name    string
+	cluster Cluster
+	user    AuthInfo
+	profile string
+	region  string
+	err     error
+}
+
+// runUpdateKubeconfig implements `eks update-kubeconfig`
+func runUpdateKubeconfig(g globalOptions, args []string) {
+	var opts getTokenOptions
+	updateCmd := flag.NewFlagSet("update-kubeconfig", flag.ExitOnError)
+	cluster := updateCmd.String("cluster-name", "", "EKS cluster name or ARN (required unless --all is given)")
+	updateCmd.StringVar(&g.region, "region", g.region, "AWS region of the cluster (default the global --region)")
+	roleARN := updateCmd.String("role-arn", "", "IAM role to assume before signing tokens")
+	kubeconfigPath := updateCmd.String("kubeconfig", "", "Kubeconfig file to update (default the first file of $KUBECONFIG, else ~/.kube/config)")
+	alias := updateCmd.String("alias", "", "Name of the context (default the cluster ARN)")
+	userAlias := updateCmd.String("user-alias", "", "Name of the user (default the cluster ARN)")
+	nameTemplate := updateCmd.String("context-name-template", settings.ContextNameTemplate, "Go template for context names, with fields Cluster, Region, Account and Profile (default the cluster ARN)")
+	all := updateCmd.Bool("all", false, "Add every cluster found in the configured regions, else --region, else all enabled regions")
+	allProfiles := updateCmd.Bool("all-profiles", false, "With --all, list clusters with every profile of the fallback chain rather than the first working one")
+	dryRun := updateCmd.Bool("dry-run", false, "Print the changes to the kubeconfig, field by field, instead of writing it")
+	updateCmd.BoolVar(&opts.discoverRegion, "discover-region", false, "Find the cluster's region by listing clusters in all enabled regions, unless --region is given")
+	if err := updateCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "error parsing arguments: %s\n", err)
+		os.Exit(exitUsage)
+	}
+	if *all == (*cluster != "") {
+		fmt.Fprintln(os.Stderr, "exactly one of --cluster-name or --all is required")
+		os.Exit(exitUsage)
+	}
+	if *all && (*alias != "" || *userAlias != "") {
+		fmt.Fprintln(os.Stderr, "--alias and --user-alias cannot be combined with --all")
+		os.Exit(exitUsage)
+	}
+	if *allProfiles && !*all {
+		fmt.Fprintln(os.Stderr, "--all-profiles requires --all")
+		os.Exit(exitUsage)
+	}
+	var contextTemplate *template.Template
+	if *nameTemplate != "" && *alias == "" {
+		var err error
+		if contextTemplate, err = template.New("context-name").Parse(*nameTemplate); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --context-name-template: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	t, err := newTokenTarget(g, *cluster, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	t.roleARN = *roleARN
+
+	path := *kubeconfigPath
+	if path == "" {
+		paths, err := kubeconfigPaths()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to locate kubeconfig: %v\n", err)
+			os.Exit(1)
+		}
+		path = paths[0]
+	}
+	kc, err := readKubeconfig(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		kc, err = &Kubeconfig{APIVersion: "v1", Kind: "Config"}, nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	before := cloneKubeconfig(kc)
+
+	ctx := context.Background()
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+
+	var updates []kubeconfigUpdate
+	if *all {
+		updates = listKubeconfigUpdates(ctx, g, t, *allProfiles)
+	} else {
+		cfg, profile, err := loadTargetConfig(ctx, opts, t)
+		if err != nil {
+			os.Exit(reportGetTokenError(g, err))
+		}
+		name, entry, err := describeKubeconfigCluster(ctx, cfg, t.cluster)
+		if err != nil {
+			os.Exit(reportGetTokenError(g, err))
+		}
+		updates = append(updates, kubeconfigUpdate{
+			name:    name,
+			cluster: entry,
+			user:    execAuthInfo(cfg.Region, profile, t),
+			profile: profile,
+			region:  cfg.Region,
+		})
+	}
+
+	// With --all, the summary table lists every cluster and failure
+	summary := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(summary, "CONTEXT\tPROFILE\tREGION\tSTATUS")
+	failed := 0
+	// Context names given to the clusters of this run, to catch templates yielding the same name twice
+	named := map[string]string{}
+	// Profiles the clusters were added with, as with --all-profiles a cluster may be reachable through several
+	added := map[string]string{}
+	for _, u := range updates {
+		if u.err != nil {
+			fmt.Fprintf(summary, "-\t%s\t%s\tfailed: %v\n", u.profile, u.region, u.err)
+			failed = exitCode(u.err)
+			continue
+		}
+		if profile, ok := added[u.name]; ok {
+			fmt.Fprintf(summary, "-\t%s\t%s\tskipped: %s already added with profile %s\n", u.profile, u.region, u.name, profile)
+			continue
+		}
+		added[u.name] = u.profile
+		contextName, userName := u.name, u.name
+		if *alias != "" {
+			contextName = *alias
+		} else if contextTemplate != nil {
+			var err error
+			if contextName, err = templateContextName(contextTemplate, u); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid --context-name-template: %v\n", err)
+				os.Exit(exitUsage)
+			}
+		}
+		if other, ok := named[contextName]; ok && other != u.name {
+			fmt.Fprintf(summary, "%s\t%s\t%s\tfailed: context name already taken by %s\n", contextName, u.profile, u.region, other)
+			failed = 1
+			continue
+		}
+		named[contextName] = u.name
+		if *userAlias != "" {
+			userName = *userAlias
+		}
+		status := "added"
+		if kc.context(contextName) != nil {
+			status = "updated"
+		}
+		kc.setCluster(u.name, u.cluster)
+		kc.setUser(userName, u.user)
+		kc.setContext(contextName, u.name, userName)
+		if !*all {
+			kc.CurrentContext = contextName
+		}
+		fmt.Fprintf(summary, "%s\t%s\t%s\t%s\n", contextName, u.profile, u.region, status)
+	}
+
+	if *dryRun {
+		for _, c := range diffKubeconfigs(before, kc) {
+			fmt.Fprintln(stdout, c)
+		}
+	} else if err := writeKubeconfigWithBackup(path, kc); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write kubeconfig: %v\n", err)
+		os.Exit(1)
+	}
+	if *all {
+		summary.Flush()
+	} else if !*dryRun {
+		fmt.Fprintf(os.Stderr, "Updated context %s in %s\n", kc.CurrentContext, path)
+	}
+	if failed != 0 {
+		os.Exit(failed)
+	}
+}
+
+// contextNameFields are the fields available to --context-name-template
+type contextNameFields struct {
+	Cluster string
+	Region  string
+	Account string
+	Profile string
+}
+
+// templateContextName renders the context name of an update with the --context-name-template
+func templateContextName(tmpl *template.Template, u kubeconfigUpdate) (string, error) {
+	parsed, err := parseClusterARN(u.name)
+	if err != nil {
+		return "", err
+	}
+	var name strings.Builder
+	fields := contextNameFields{Cluster: parsed.Name, Region: parsed.Region, Account: parsed.Account, Profile: u.profile}
+	if err := tmpl.Execute(&name, fields); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(name.String()) == "" {
+		return "", fmt.Errorf("empty context name for cluster %s", u.name)
+	}
+	return name.String(), nil
+}
+
+// listKubeconfigUpdates lists and describes the clusters in all configured regions in parallel, with the
+// first working profile of the target, or with each of its profiles if allProfiles is set. The updates are
+// sorted by cluster ARN, then by the order of the profiles.
+func listKubeconfigUpdates(ctx context.Context, g globalOptions, t tokenTarget, allProfiles bool) []kubeconfigUpdate {
+	chains := [][]string{t.profiles}
+	if allProfiles {
+		chains = nil
+		for _, profile := range t.profiles {
+			chains = append(chains, []string{profile})
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		updates []kubeconfigUpdate
+	)
+	add := func(u kubeconfigUpdate) {
+		mu.Lock()
+		defer mu.Unlock()
+		updates = append(updates, u)
+	}
+	for _, profiles := range chains {
+		cfg, profile, err := loadFirstWorkingConfig(ctx, "", t.roleARN, profiles, config.WithDefaultRegion(discoveryBaseRegion))
+		if err != nil {
+			add(kubeconfigUpdate{profile: profiles[0], region: "-", err: err})
+			continue
+		}
+		regions, err := kubeconfigRegions(ctx, cfg, g)
+		if err != nil {
+			add(kubeconfigUpdate{profile: profile, region: "-", err: err})
+			continue
+		}
+		for _, region := range regions {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rcfg := cfg.Copy()
+				rcfg.Region = region
+				names, err := listClusters(ctx, rcfg)
+				if err != nil {
+					add(kubeconfigUpdate{profile: profile, region: region, err: err})
+					return
+				}
+				for _, name := range names {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						arn, entry, err := describeKubeconfigCluster(ctx, rcfg, name)
+						if err != nil {
+							err = fmt.Errorf("%s: %w", name, err)
+						}
+						target := tokenTarget{cluster: name, roleARN: t.roleARN}
+						add(kubeconfigUpdate{name: arn, cluster: entry, user: execAuthInfo(region, profile, target), profile: profile, region: region, err: err})
+					}()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(updates, func(i, j int) bool {
+		if updates[i].name != updates[j].name {
+			return updates[i].name < updates[j].name
+		}
+		return slices.Index(t.profiles, updates[i].profile) < slices.Index(t.profiles, updates[j].profile)
+	})
+	return updates
+}
+
+// kubeconfigRegions returns the regions to list clusters in: the regions of the configuration file, else
+// --region, else all enabled regions
+func kubeconfigRegions(ctx context.Context, cfg aws.Config, g globalOptions) ([]string, error) {
+	if len(settings.Regions) > 0 {
+		return settings.Regions, nil
+	}
+	if g.region != "" {
+		return []string{g.region}, nil
+	}
+	return enabledRegions(ctx, cfg)
+}
+
+// enabledRegions returns the regions enabled for the account
+func enabledRegions(ctx context.Context, cfg aws.Config) ([]string, error) {
+	out, err := ec2.NewFromConfig(cfg).DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list enabled regions: %w", err)
+	}
+	var regions []string
+	for _, r := range out.Regions {
+		regions = append(regions, aws.ToString(r.RegionName))
+	}
+	return regions, nil
+}
+
+// listClusters returns the names of all clusters in the config's region
+func listClusters(ctx context.Context, cfg aws.Config) ([]string, error) {
+	var names []string
+	paginator := eks.NewListClustersPaginator(eks.NewFromConfig(cfg), &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list clusters: %w", err)
+		}
+		names = append(names, page.Clusters...)
+	}
+	return names, nil
+}
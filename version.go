@@ -0,0 +1,17 @@
+package main
+
+import "runtime/debug"
+
+// version is set at release build time via -ldflags "-X main.version=..."
+var version = ""
+
+// toolVersion returns the version of this tool, falling back to the module version for `go install` builds
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "dev"
+}